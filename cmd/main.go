@@ -1,24 +1,28 @@
 package main
 
 import (
-	"flag"
+	"context"
+	"expvar"
 	"fmt"
+	"interview-fm-backend/internal/config"
+	"interview-fm-backend/internal/entities"
 	"interview-fm-backend/internal/logger"
 	"interview-fm-backend/internal/routes"
 	"interview-fm-backend/internal/service/fetch"
 	"interview-fm-backend/internal/service/orchestrator"
 	"interview-fm-backend/internal/service/resize"
+	"interview-fm-backend/internal/service/webhook"
 	appCache "interview-fm-backend/internal/storage/cache"
+	"net/netip"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
-var appPort = flag.String("port", "8080", "App listen port")
-var imageStorageHost = flag.String("imagehost", "http://localhost:8080", "Url to image storage service")
-
 type Shutdowner interface {
 	Shutdown() error
 }
@@ -29,42 +33,109 @@ type ShutdownItem struct {
 }
 
 func main() {
-	flag.Parse()
 	log, err := logger.NewAppLogger()
 	if err != nil {
 		println(fmt.Errorf("error init logger: %w", err))
 		return
 	}
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv)
+	if err != nil {
+		log.Fatal("Failed to load config", err)
+	}
+	if err = log.SetLevel(cfg.Log.Level); err != nil {
+		log.Fatal("Failed to set log level", err)
+	}
 
-	cache, err := appCache.NewCache()
+	cache, err := initCache(cfg, log)
 	if err != nil {
 		log.Fatal("Failed to create cache", err)
 	}
+	if stats, ok := cache.(appCache.StatsProvider); ok {
+		expvar.Publish("cache", expvar.Func(func() any {
+			return stats.Stats()
+		}))
+	}
+
+	// notifier stays nil interface, if callbacks are disabled, so requests with callback url are rejected
+	var notifier webhook.Notifier
+	var webhookService *webhook.Service
+	if cfg.Webhook.Enabled {
+		webhookService, err = webhook.NewService(webhook.Config{
+			Secret:         cfg.Webhook.Secret,
+			MaxAttempts:    cfg.Webhook.Attempts,
+			InitialBackoff: cfg.Webhook.InitialBackoff,
+			MaxBackoff:     cfg.Webhook.MaxBackoff,
+			Timeout:        cfg.Webhook.Timeout,
+			DeadLetterPath: cfg.Webhook.DeadLetter,
+
+			AllowedNetworks: parseNetworks(cfg.Webhook.AllowedNetworks),
+		}, log)
+		if err != nil {
+			log.Fatal("Failed to create webhook notifier", err)
+		}
+		notifier = webhookService
+	}
 
-	resizer := orchestrator.NewService(*imageStorageHost, resize.NewResizerService(), fetch.NewService(), cache, log)
-	app := routes.InitAppRouter(*appPort, resizer)
+	fetcher := fetch.NewService(fetchConfig(cfg))
+	expvar.Publish("fetch", expvar.Func(func() any {
+		return fetcher.Stats()
+	}))
+	resizer := orchestrator.NewService(orchestratorConfig(cfg), resize.NewResizerService(), fetcher, notifier, cache, log)
+	expvar.Publish("queue", expvar.Func(func() any {
+		return resizer.QueueStats()
+	}))
+	expvar.Publish("source_cache", expvar.Func(func() any {
+		return resizer.SourceCacheStats()
+	}))
+	app := routes.InitAppRouter(routes.Config{
+		Port:      cfg.Server.Port,
+		BodyLimit: cfg.Server.BodyLimit,
+	}, resizer)
 	go func() {
-		log.Info("starting service", zap.String("port", *appPort))
+		log.Info("starting service", zap.String("port", cfg.Server.Port))
 		if err = app.Run(); err != nil {
 			log.Fatal("error start service", err)
 		}
 	}()
+	var admin *routes.AdminRouter
+	if cfg.Server.AdminAddr != "" {
+		admin = routes.InitAdminRouter(cfg.Server.AdminAddr)
+		go func() {
+			log.Info("starting admin server", zap.String("addr", cfg.Server.AdminAddr))
+			if adminErr := admin.Run(); adminErr != nil {
+				log.Fatal("error start admin server", adminErr)
+			}
+		}()
+	}
 
-	// register app shutdown
+	// register app shutdown and config reload
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	<-c // This blocks the main thread until an interrupt is received
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	// This blocks the main thread until an interrupt is received
+	for sig := range c {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		cfg = reloadConfig(cfg, log, fetcher, resizer, cache)
+	}
 
 	// not using context, because order is important
-	// 1. stop router, stop accept new requests
+	// 1. stop routers, stop accept new requests
 	// 2. stop resizer and save cache
-	// 3. stop cache and dump data
-	// 4. exit app
+	// 3. stop webhook notifier, resizer has already finished callbacks
+	// 4. stop cache and dump data
+	// 5. exit app
 	shutdownItems := []ShutdownItem{
 		{"router", app},
-		{"resizer", resizer},
-		{"cache", cache},
 	}
+	if admin != nil {
+		shutdownItems = append(shutdownItems, ShutdownItem{"admin", admin})
+	}
+	shutdownItems = append(shutdownItems, ShutdownItem{"resizer", resizer})
+	if webhookService != nil {
+		shutdownItems = append(shutdownItems, ShutdownItem{"webhook", webhookService})
+	}
+	shutdownItems = append(shutdownItems, ShutdownItem{"cache", cache})
 
 	for i := range shutdownItems {
 		log.Info("shutdown service", zap.String("service", shutdownItems[i].Name))
@@ -74,3 +145,174 @@ func main() {
 	}
 	log.Info("app was successful shutdown")
 }
+
+// reloadConfig loads config again and applies settings, which can be changed without restart.
+// If loaded config is invalid, running config is kept.
+func reloadConfig(
+	cfg config.Config,
+	log *logger.Logger,
+	fetcher *fetch.Service,
+	resizer *orchestrator.Service,
+	cache appCache.Cacher,
+) config.Config {
+	log.Info("reloading config")
+	loaded, err := config.Load(os.Args[1:], os.LookupEnv)
+	if err != nil {
+		log.Error("failed to reload config, keep running one", err)
+		return cfg
+	}
+	cfg, changes := config.Reload(cfg, loaded)
+	for _, change := range changes {
+		fields := []zapcore.Field{zap.String("setting", change.Key), zap.String("old", change.Old), zap.String("new", change.New)}
+		if change.Applied {
+			log.Info("setting changed", fields...)
+		} else {
+			log.Info("setting requires restart, ignored", fields...)
+		}
+	}
+	if err = log.SetLevel(cfg.Log.Level); err != nil {
+		log.Error("failed to set log level", err)
+	}
+	fetcher.SetConfig(fetchConfig(cfg))
+	resizer.Reload(orchestratorConfig(cfg))
+	if err = resizeCache(cache, cfg.Cache); err != nil {
+		log.Error("failed to resize cache", err)
+	}
+	log.Info("config reloaded", zap.Int("changes", len(changes)))
+	return cfg
+}
+
+func fetchConfig(cfg config.Config) fetch.Config {
+	retry := cfg.Fetch.Retry
+	// classes and networks are already validated with config
+	classes := make([]fetch.ErrorClass, 0, len(retry.Classes))
+	for _, name := range retry.Classes {
+		class, _ := entities.ParseFetchErrorClass(name)
+		classes = append(classes, class)
+	}
+	return fetch.Config{
+		MaxSize:         cfg.Fetch.MaxSize,
+		AllowedSchemes:  cfg.Fetch.AllowedSchemes,
+		AllowedHosts:    cfg.Fetch.AllowedHosts,
+		DeniedHosts:     cfg.Fetch.DeniedHosts,
+		AllowedNetworks: parseNetworks(cfg.Fetch.AllowedNetworks),
+		Retry: fetch.RetryConfig{
+			MaxAttempts:    retry.MaxAttempts,
+			InitialBackoff: retry.InitialBackoff,
+			MaxBackoff:     retry.MaxBackoff,
+			MaxRetryAfter:  retry.MaxRetryAfter,
+			Classes:        classes,
+		},
+		Client: fetch.ClientConfig{
+			Timeout:               cfg.Fetch.Client.Timeout,
+			DialTimeout:           cfg.Fetch.Client.DialTimeout,
+			TLSHandshakeTimeout:   cfg.Fetch.Client.TLSHandshakeTimeout,
+			ResponseHeaderTimeout: cfg.Fetch.Client.ResponseHeaderTimeout,
+			IdleConnTimeout:       cfg.Fetch.Client.IdleConnTimeout,
+			MaxIdleConns:          cfg.Fetch.Client.MaxIdleConns,
+			MaxIdleConnsPerHost:   cfg.Fetch.Client.MaxIdleConnsPerHost,
+			MaxConnsPerHost:       cfg.Fetch.Client.MaxConnsPerHost,
+			DisableHTTP2:          cfg.Fetch.Client.DisableHTTP2,
+			MaxRedirects:          cfg.Fetch.Client.MaxRedirects,
+			UserAgent:             cfg.Fetch.Client.UserAgent,
+		},
+	}
+}
+
+// parseNetworks converts CIDR list, which is already validated with config.
+func parseNetworks(list []string) []netip.Prefix {
+	networks := make([]netip.Prefix, 0, len(list))
+	for _, network := range list {
+		prefix, _ := netip.ParsePrefix(network)
+		networks = append(networks, prefix)
+	}
+	return networks
+}
+
+func orchestratorConfig(cfg config.Config) orchestrator.Config {
+	return orchestrator.Config{
+		BaseURL:                cfg.Orchestrator.ImageHost,
+		JournalPath:            cfg.Orchestrator.QueueJournal,
+		MaxSyncRequests:        cfg.Orchestrator.MaxSyncRequests,
+		MaxAsyncRequests:       cfg.Orchestrator.MaxAsyncRequests,
+		MaxQueueSize:           cfg.Orchestrator.MaxQueueSize,
+		MaxClientSyncRequests:  cfg.Orchestrator.MaxClientSyncRequests,
+		MaxClientAsyncRequests: cfg.Orchestrator.MaxClientAsyncRequests,
+		MaxClientQueueSize:     cfg.Orchestrator.MaxClientQueueSize,
+		TaskTimeout:            cfg.Orchestrator.TaskTimeout,
+		ImageWaitTimeout:       cfg.Orchestrator.ImageWaitTimeout,
+		SourceCacheSize:        cfg.Cache.SourceSize,
+		SourceCacheTTL:         cfg.Cache.SourceTTL,
+	}
+}
+
+// resizeCache changes capacity of memory and disk caches, other caches are not bounded by this service.
+func resizeCache(cache appCache.Cacher, cfg config.CacheConfig) error {
+	switch cache := cache.(type) {
+	case *appCache.LRU:
+		return cache.SetCapacity(cfg.Size)
+	case *appCache.Disk:
+		return cache.SetCapacity(cfg.DiskSize)
+	case *appCache.TwoTier:
+		memory, durable := cache.Tiers()
+		if err := memory.SetCapacity(cfg.Size); err != nil {
+			return err
+		}
+		return resizeCache(durable, cfg)
+	}
+	return nil
+}
+
+func initCache(appCfg config.Config, log logger.AppLogger) (appCache.Cacher, error) {
+	cfg := appCfg.Cache
+	// every processing image can use own connection
+	poolSize := appCfg.Orchestrator.MaxSyncRequests + appCfg.Orchestrator.MaxAsyncRequests
+	if cfg.Type == "memory" || !cfg.MemoryTier {
+		return initStorage(cfg, poolSize, log)
+	}
+	durable, err := initStorage(cfg, poolSize, log)
+	if err != nil {
+		return nil, err
+	}
+	// durable tier already keeps all items, so memory tier snapshot is not needed
+	memory, err := appCache.NewCache(cfg.Size, "", log)
+	if err != nil {
+		return nil, err
+	}
+	return appCache.NewTwoTierCache(memory, durable, log), nil
+}
+
+func initStorage(cfg config.CacheConfig, redisPoolSize int, log logger.AppLogger) (appCache.Cacher, error) {
+	switch cfg.Type {
+	case "memory":
+		return appCache.NewCache(cfg.Size, cfg.Snapshot, log)
+	case "disk":
+		return appCache.NewDiskCache(cfg.Dir, cfg.DiskSize, log)
+	case "redis":
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return appCache.NewRedisCache(ctx, appCache.RedisConfig{
+			Addr:      cfg.Redis.Addr,
+			Password:  cfg.Redis.Password,
+			DB:        cfg.Redis.DB,
+			KeyPrefix: cfg.Redis.Prefix,
+			TTL:       cfg.Redis.TTL,
+			PoolSize:  redisPoolSize,
+			Timeout:   cfg.Redis.Timeout,
+		}, log)
+	case "s3":
+		return appCache.NewS3Cache(appCache.S3Config{
+			Endpoint:      cfg.S3.Endpoint,
+			Bucket:        cfg.S3.Bucket,
+			Region:        cfg.S3.Region,
+			AccessKey:     cfg.S3.AccessKey,
+			SecretKey:     cfg.S3.SecretKey,
+			KeyPrefix:     cfg.S3.Prefix,
+			URLMode:       appCache.S3URLMode(cfg.S3.URLMode),
+			PublicURL:     cfg.S3.PublicURL,
+			PresignExpiry: cfg.S3.PresignExpiry,
+			Timeout:       cfg.S3.Timeout,
+		}, log)
+	}
+	return nil, fmt.Errorf("unknown cache type: %s", cfg.Type)
+}
@@ -0,0 +1,496 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"interview-fm-backend/internal/entities"
+	"io"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is configuration of application. Values are taken from defaults, then from optional YAML file,
+// then from environment variables and at last from command line flags, so flags have the highest priority.
+// Fields tagged by `reload` can be changed without restart, see Reload.
+type Config struct {
+	Log          LogConfig          `yaml:"log"`
+	Server       ServerConfig       `yaml:"server"`
+	Orchestrator OrchestratorConfig `yaml:"orchestrator"`
+	Fetch        FetchConfig        `yaml:"fetch"`
+	Cache        CacheConfig        `yaml:"cache"`
+	Webhook      WebhookConfig      `yaml:"webhook"`
+}
+
+type LogConfig struct {
+	Level string `yaml:"level" reload:"true"` // debug, info, warn or error
+}
+
+type ServerConfig struct {
+	Port      string `yaml:"port"`
+	BodyLimit int    `yaml:"body_limit"` // max size of request body in bytes
+	AdminAddr string `yaml:"admin_addr"` // listen address of metrics, should not be public
+}
+
+type OrchestratorConfig struct {
+	ImageHost    string `yaml:"image_host" reload:"true"`    // url of service, which serves images
+	QueueJournal string `yaml:"queue_journal" reload:"true"` // file to store pending async tasks between restarts
+
+	MaxSyncRequests        int `yaml:"max_sync_requests" reload:"true"`
+	MaxAsyncRequests       int `yaml:"max_async_requests" reload:"true"`
+	MaxQueueSize           int `yaml:"max_queue_size" reload:"true"`
+	MaxClientSyncRequests  int `yaml:"max_client_sync_requests" reload:"true"`
+	MaxClientAsyncRequests int `yaml:"max_client_async_requests" reload:"true"`
+	MaxClientQueueSize     int `yaml:"max_client_queue_size" reload:"true"`
+
+	TaskTimeout      time.Duration `yaml:"task_timeout" reload:"true"`
+	ImageWaitTimeout time.Duration `yaml:"image_wait_timeout" reload:"true"`
+}
+
+type FetchConfig struct {
+	MaxSize int64 `yaml:"max_size" reload:"true"` // max size of source image in bytes
+	// AllowedSchemes are url schemes images can be fetched by
+	AllowedSchemes []string `yaml:"allowed_schemes" reload:"true"`
+	// AllowedHosts empty list allows any host, `.example.com` allows subdomains
+	AllowedHosts []string `yaml:"allowed_hosts" reload:"true"`
+	// DeniedHosts are blocked even if they are allowed
+	DeniedHosts []string `yaml:"denied_hosts" reload:"true"`
+	// AllowedNetworks are CIDR exceptions from blocked loopback, private, link-local and other special networks
+	AllowedNetworks []string `yaml:"allowed_networks" reload:"true"`
+
+	Retry  FetchRetryConfig  `yaml:"retry"`
+	Client FetchClientConfig `yaml:"client"`
+}
+
+type FetchRetryConfig struct {
+	MaxAttempts    int           `yaml:"max_attempts" reload:"true"`    // 1 disables retries
+	InitialBackoff time.Duration `yaml:"initial_backoff" reload:"true"` // doubled for each next attempt
+	MaxBackoff     time.Duration `yaml:"max_backoff" reload:"true"`
+	MaxRetryAfter  time.Duration `yaml:"max_retry_after" reload:"true"` // longer delay requested by server fails fetch
+	Classes        []string      `yaml:"classes" reload:"true"`         // retried classes of failures
+}
+
+// FetchClientConfig tunes connections to source image hosts, only redirects and User-Agent are applied on reload.
+type FetchClientConfig struct {
+	Timeout               time.Duration `yaml:"timeout"` // total time of single download attempt
+	DialTimeout           time.Duration `yaml:"dial_timeout"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"`
+	IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout"`
+	MaxIdleConns          int           `yaml:"max_idle_conns"`
+	MaxIdleConnsPerHost   int           `yaml:"max_idle_conns_per_host"`
+	MaxConnsPerHost       int           `yaml:"max_conns_per_host"` // 0 means no limit
+	DisableHTTP2          bool          `yaml:"disable_http2"`
+	MaxRedirects          int           `yaml:"max_redirects" reload:"true"`
+	UserAgent             string        `yaml:"user_agent" reload:"true"`
+}
+
+type CacheConfig struct {
+	Type       string `yaml:"type"`               // memory, disk, redis or s3
+	Size       int64  `yaml:"size" reload:"true"` // max size of memory cache in bytes
+	Snapshot   string `yaml:"snapshot"`           // snapshot file of memory cache
+	MemoryTier bool   `yaml:"memory_tier"`        // keep memory cache in front of disk, redis or s3 cache
+	Dir        string `yaml:"dir"`
+	DiskSize   int64  `yaml:"disk_size" reload:"true"`
+
+	// SourceSize is max size of downloaded source images kept in memory for resizing to other sizes, 0 disables it
+	SourceSize int64 `yaml:"source_size" reload:"true"`
+	// SourceTTL is how long source image without `max-age` is used without requests to source, 0 disables it
+	SourceTTL time.Duration `yaml:"source_ttl" reload:"true"`
+
+	Redis RedisConfig `yaml:"redis"`
+	S3    S3Config    `yaml:"s3"`
+}
+
+type RedisConfig struct {
+	Addr     string        `yaml:"addr"`
+	Password string        `yaml:"password" secret:"true"`
+	DB       int           `yaml:"db"`
+	Prefix   string        `yaml:"prefix"`
+	TTL      time.Duration `yaml:"ttl"`
+	Timeout  time.Duration `yaml:"timeout"` // timeout of single redis command
+}
+
+type S3Config struct {
+	Endpoint      string        `yaml:"endpoint"`
+	Bucket        string        `yaml:"bucket"`
+	Region        string        `yaml:"region"`
+	Prefix        string        `yaml:"prefix"`
+	URLMode       string        `yaml:"url_mode"`
+	PublicURL     string        `yaml:"public_url"`
+	PresignExpiry time.Duration `yaml:"presign_expiry"`
+	Timeout       time.Duration `yaml:"timeout"` // timeout of single request to bucket
+	AccessKey     string        `yaml:"access_key" secret:"true"`
+	SecretKey     string        `yaml:"secret_key" secret:"true"`
+}
+
+type WebhookConfig struct {
+	Enabled    bool   `yaml:"enabled"` // accept callback urls of async requests, requires secret
+	Secret     string `yaml:"secret" secret:"true"`
+	Attempts   int    `yaml:"attempts"`
+	DeadLetter string `yaml:"dead_letter"`
+
+	InitialBackoff time.Duration `yaml:"initial_backoff"` // doubled for each next attempt
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+	Timeout        time.Duration `yaml:"timeout"` // timeout of single delivery attempt
+	// AllowedNetworks are CIDR exceptions from blocked internal networks for callback receivers
+	AllowedNetworks []string `yaml:"allowed_networks"`
+}
+
+// Default returns configuration used when nothing is set.
+func Default() Config {
+	return Config{
+		Log: LogConfig{
+			Level: "info",
+		},
+		Server: ServerConfig{
+			Port:      "8080",
+			BodyLimit: 8 * 1024,
+			AdminAddr: "127.0.0.1:9090",
+		},
+		Orchestrator: OrchestratorConfig{
+			ImageHost:              "http://localhost:8080",
+			QueueJournal:           "queue.journal",
+			MaxSyncRequests:        10,
+			MaxAsyncRequests:       10,
+			MaxQueueSize:           1000,
+			MaxClientSyncRequests:  5,
+			MaxClientAsyncRequests: 5,
+			MaxClientQueueSize:     500,
+			TaskTimeout:            10 * time.Second,
+			ImageWaitTimeout:       30 * time.Second,
+		},
+		Fetch: FetchConfig{
+			MaxSize:        15 * 1024 * 1024,
+			AllowedSchemes: []string{"http", "https"},
+			Retry: FetchRetryConfig{
+				MaxAttempts:    3,
+				InitialBackoff: 200 * time.Millisecond,
+				MaxBackoff:     2 * time.Second,
+				MaxRetryAfter:  5 * time.Second,
+				Classes:        []string{"network", "timeout", "throttled", "server"},
+			},
+			Client: FetchClientConfig{
+				Timeout:               30 * time.Second,
+				DialTimeout:           5 * time.Second,
+				TLSHandshakeTimeout:   5 * time.Second,
+				ResponseHeaderTimeout: 10 * time.Second,
+				IdleConnTimeout:       90 * time.Second,
+				MaxIdleConns:          100,
+				MaxIdleConnsPerHost:   10,
+				MaxConnsPerHost:       20,
+				MaxRedirects:          5,
+				UserAgent:             "interview-fm-backend/1.0",
+			},
+		},
+		Cache: CacheConfig{
+			Type:     "memory",
+			Size:     256 * 1024 * 1024,
+			Snapshot: "cache.snapshot",
+			Dir:      "cache_data",
+			DiskSize: 1024 * 1024 * 1024,
+
+			SourceSize: 64 * 1024 * 1024,
+
+			Redis: RedisConfig{
+				Addr:    "localhost:6379",
+				Prefix:  "image:",
+				Timeout: time.Second,
+			},
+			S3: S3Config{
+				Endpoint:      "https://s3.amazonaws.com",
+				Region:        "us-east-1",
+				Prefix:        "resized/",
+				URLMode:       "proxy",
+				PresignExpiry: 24 * time.Hour,
+				Timeout:       10 * time.Second,
+			},
+		},
+		Webhook: WebhookConfig{
+			Attempts:   5,
+			DeadLetter: "webhook.deadletter",
+
+			InitialBackoff: time.Second,
+			MaxBackoff:     time.Minute,
+			Timeout:        10 * time.Second,
+		},
+	}
+}
+
+// option binds command line flag and environment variable to config field.
+// Secrets have no flag, so they don't appear in process list.
+type option struct {
+	flag  string
+	env   string
+	usage string
+	field any
+}
+
+func (c *Config) options() []option {
+	return []option{
+		{"loglevel", "LOG_LEVEL", "Log level: `debug`, `info`, `warn` or `error`", &c.Log.Level},
+
+		{"port", "PORT", "App listen port", &c.Server.Port},
+		{"bodylimit", "BODY_LIMIT", "Max size of request body in bytes", &c.Server.BodyLimit},
+		{"adminaddr", "ADMIN_ADDR", "Listen address of admin server with metrics on /debug/vars, empty disables it", &c.Server.AdminAddr},
+
+		{"imagehost", "IMAGE_HOST", "Url to image storage service", &c.Orchestrator.ImageHost},
+		{"queuejournal", "QUEUE_JOURNAL", "File to store pending async tasks between restarts, empty disables it", &c.Orchestrator.QueueJournal},
+		{"maxsyncrequests", "MAX_SYNC_REQUESTS", "Max parallel processing of sync images", &c.Orchestrator.MaxSyncRequests},
+		{"maxasyncrequests", "MAX_ASYNC_REQUESTS", "Max parallel processing of async images", &c.Orchestrator.MaxAsyncRequests},
+		{"queuesize", "QUEUE_SIZE", "Max async images waiting in queue", &c.Orchestrator.MaxQueueSize},
+		{"clientsyncrequests", "CLIENT_SYNC_REQUESTS", "Max parallel processing of sync images of single client", &c.Orchestrator.MaxClientSyncRequests},
+		{"clientasyncrequests", "CLIENT_ASYNC_REQUESTS", "Max parallel processing of async images of single client", &c.Orchestrator.MaxClientAsyncRequests},
+		{"clientqueuesize", "CLIENT_QUEUE_SIZE", "Max async images of single client waiting in queue", &c.Orchestrator.MaxClientQueueSize},
+		{"tasktimeout", "TASK_TIMEOUT", "Timeout of async image processing", &c.Orchestrator.TaskTimeout},
+		{"imagewaittimeout", "IMAGE_WAIT_TIMEOUT", "How long image request waits for async processing", &c.Orchestrator.ImageWaitTimeout},
+
+		{"fetchmaxsize", "FETCH_MAX_SIZE", "Max size of source image in bytes", &c.Fetch.MaxSize},
+		{"fetchallowedschemes", "FETCH_ALLOWED_SCHEMES", "Comma separated url schemes images can be fetched by", &c.Fetch.AllowedSchemes},
+		{"fetchallowedhosts", "FETCH_ALLOWED_HOSTS", "Comma separated hosts images can be fetched from, `.example.com` allows subdomains. Empty allows any host", &c.Fetch.AllowedHosts},
+		{"fetchdeniedhosts", "FETCH_DENIED_HOSTS", "Comma separated hosts images can't be fetched from, even if they are allowed", &c.Fetch.DeniedHosts},
+		{"fetchallowednetworks", "FETCH_ALLOWED_NETWORKS", "Comma separated CIDR exceptions from blocked loopback, private and other internal networks", &c.Fetch.AllowedNetworks},
+		{"fetchattempts", "FETCH_ATTEMPTS", "Max download attempts of source image, 1 disables retries", &c.Fetch.Retry.MaxAttempts},
+		{"fetchbackoff", "FETCH_BACKOFF", "Delay before second download attempt, doubled for each next one", &c.Fetch.Retry.InitialBackoff},
+		{"fetchmaxbackoff", "FETCH_MAX_BACKOFF", "Max delay between download attempts", &c.Fetch.Retry.MaxBackoff},
+		{"fetchmaxretryafter", "FETCH_MAX_RETRY_AFTER", "Max delay requested by `Retry-After` header, longer one fails download", &c.Fetch.Retry.MaxRetryAfter},
+		{"fetchretryon", "FETCH_RETRY_ON", "Comma separated retried failures: network, timeout, throttled, server, client, invalid", &c.Fetch.Retry.Classes},
+		{"fetchtimeout", "FETCH_TIMEOUT", "Total time of single download attempt, including body", &c.Fetch.Client.Timeout},
+		{"fetchdialtimeout", "FETCH_DIAL_TIMEOUT", "Timeout of connecting to source image host", &c.Fetch.Client.DialTimeout},
+		{"fetchtlstimeout", "FETCH_TLS_TIMEOUT", "Timeout of TLS handshake with source image host", &c.Fetch.Client.TLSHandshakeTimeout},
+		{"fetchheadertimeout", "FETCH_HEADER_TIMEOUT", "Timeout of waiting for response headers after request is sent", &c.Fetch.Client.ResponseHeaderTimeout},
+		{"fetchidletimeout", "FETCH_IDLE_TIMEOUT", "Idle connections to source image hosts are closed after timeout", &c.Fetch.Client.IdleConnTimeout},
+		{"fetchmaxidleconns", "FETCH_MAX_IDLE_CONNS", "Max idle connections to all source image hosts", &c.Fetch.Client.MaxIdleConns},
+		{"fetchmaxidleconnsperhost", "FETCH_MAX_IDLE_CONNS_PER_HOST", "Max idle connections kept for each source image host", &c.Fetch.Client.MaxIdleConnsPerHost},
+		{"fetchmaxconnsperhost", "FETCH_MAX_CONNS_PER_HOST", "Max connections to each source image host, 0 means no limit", &c.Fetch.Client.MaxConnsPerHost},
+		{"fetchdisablehttp2", "FETCH_DISABLE_HTTP2", "Use only HTTP/1.1 for downloads", &c.Fetch.Client.DisableHTTP2},
+		{"fetchmaxredirects", "FETCH_MAX_REDIRECTS", "Max redirects followed by download", &c.Fetch.Client.MaxRedirects},
+		{"fetchuseragent", "FETCH_USER_AGENT", "User-Agent header of download requests", &c.Fetch.Client.UserAgent},
+
+		{"cache", "CACHE", "Cache type: `memory`, `disk`, `redis` or `s3`", &c.Cache.Type},
+		{"cachesize", "CACHE_SIZE", "Max size of memory cache in bytes", &c.Cache.Size},
+		{"cachesnapshot", "CACHE_SNAPSHOT", "Snapshot file of memory cache, empty disables snapshot", &c.Cache.Snapshot},
+		{"cachememorytier", "CACHE_MEMORY_TIER", "Keep memory cache of `-cachesize` in front of disk, redis or s3 cache", &c.Cache.MemoryTier},
+		{"cachedir", "CACHE_DIR", "Directory for disk cache", &c.Cache.Dir},
+		{"cachedisksize", "CACHE_DISK_SIZE", "Max size of disk cache in bytes", &c.Cache.DiskSize},
+		{"sourcecachesize", "SOURCE_CACHE_SIZE", "Max size of downloaded source images kept for resizing to other sizes, 0 disables it", &c.Cache.SourceSize},
+		{"sourcecachettl", "SOURCE_CACHE_TTL", "How long source image without `max-age` is used without requests to source, 0 disables it", &c.Cache.SourceTTL},
+		{"redisaddr", "REDIS_ADDR", "Redis address for redis cache", &c.Cache.Redis.Addr},
+		{"", "REDIS_PASSWORD", "", &c.Cache.Redis.Password},
+		{"redisdb", "REDIS_DB", "Redis database for redis cache", &c.Cache.Redis.DB},
+		{"redisprefix", "REDIS_PREFIX", "Prefix of keys in redis cache", &c.Cache.Redis.Prefix},
+		{"redisttl", "REDIS_TTL", "TTL of images in redis cache, 0 means no expiration", &c.Cache.Redis.TTL},
+		{"redistimeout", "REDIS_TIMEOUT", "Timeout of single redis command", &c.Cache.Redis.Timeout},
+		{"s3endpoint", "S3_ENDPOINT", "S3 compatible storage endpoint", &c.Cache.S3.Endpoint},
+		{"s3bucket", "S3_BUCKET", "Bucket for s3 cache", &c.Cache.S3.Bucket},
+		{"s3region", "S3_REGION", "Region of s3 bucket", &c.Cache.S3.Region},
+		{"s3prefix", "S3_PREFIX", "Prefix of objects in s3 bucket", &c.Cache.S3.Prefix},
+		{"s3urlmode", "S3_URL_MODE", "Urls given to clients: `proxy` - served by this service, `presigned` or `public` - bucket urls", &c.Cache.S3.URLMode},
+		{"s3publicurl", "S3_PUBLIC_URL", "Base url for public mode, like CDN url. Bucket url is used by default", &c.Cache.S3.PublicURL},
+		{"s3presignexpiry", "S3_PRESIGN_EXPIRY", "Lifetime of presigned urls", &c.Cache.S3.PresignExpiry},
+		{"s3timeout", "S3_TIMEOUT", "Timeout of single request to s3 bucket", &c.Cache.S3.Timeout},
+		{"", "AWS_ACCESS_KEY_ID", "", &c.Cache.S3.AccessKey},
+		{"", "AWS_SECRET_ACCESS_KEY", "", &c.Cache.S3.SecretKey},
+
+		{"webhook", "WEBHOOK_ENABLED", "Accept callback urls of async requests, `WEBHOOK_SECRET` env should be set", &c.Webhook.Enabled},
+		{"", "WEBHOOK_SECRET", "", &c.Webhook.Secret},
+		{"webhookattempts", "WEBHOOK_ATTEMPTS", "Max delivery attempts of async job callback", &c.Webhook.Attempts},
+		{"webhookdeadletter", "WEBHOOK_DEAD_LETTER", "File to append undelivered callbacks, empty disables it", &c.Webhook.DeadLetter},
+		{"webhookbackoff", "WEBHOOK_BACKOFF", "Delay before second delivery attempt of callback, doubled for each next one", &c.Webhook.InitialBackoff},
+		{"webhookmaxbackoff", "WEBHOOK_MAX_BACKOFF", "Max delay between delivery attempts of callback", &c.Webhook.MaxBackoff},
+		{"webhooktimeout", "WEBHOOK_TIMEOUT", "Timeout of single delivery attempt of callback", &c.Webhook.Timeout},
+		{"webhookallowednetworks", "WEBHOOK_ALLOWED_NETWORKS", "Comma separated CIDR exceptions from blocked loopback, private and other internal networks for callbacks", &c.Webhook.AllowedNetworks},
+	}
+}
+
+// Load builds configuration from command line arguments, environment and YAML file.
+// File is set by `-config` flag or `CONFIG_FILE` env, it is optional.
+func Load(args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	cfg := Default()
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	configFile, _ := lookupEnv("CONFIG_FILE")
+	fs.StringVar(&configFile, "config", configFile, "YAML config file, can be set by `CONFIG_FILE` env")
+	options := cfg.options()
+	for _, opt := range options {
+		if opt.flag == "" {
+			continue
+		}
+		usage := fmt.Sprintf("%s, can be set by `%s` env", opt.usage, opt.env)
+		if err := bindFlag(fs, opt.flag, usage, opt.field); err != nil {
+			return cfg, err
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	// flags are applied last, so values set by them are remembered and set again after file and env
+	setFlags := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = f.Value.String()
+	})
+	if configFile != "" {
+		data, err := os.ReadFile(configFile)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read config file: %w", err)
+		}
+		// unknown keys are rejected, so misspelled setting doesn't silently keep default
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, fmt.Errorf("failed to parse config file: %w", err)
+		}
+	}
+	for _, opt := range options {
+		val, ok := lookupEnv(opt.env)
+		if !ok {
+			continue
+		}
+		if err := setField(opt.field, val); err != nil {
+			return cfg, fmt.Errorf("invalid env %s: %w", opt.env, err)
+		}
+	}
+	for name, val := range setFlags {
+		if err := fs.Set(name, val); err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, cfg.Validate()
+}
+
+// setField parses value of env variable in the same way as flag value.
+func setField(field any, val string) error {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	if err := bindFlag(fs, "v", "", field); err != nil {
+		return err
+	}
+	return fs.Set("v", val)
+}
+
+func bindFlag(fs *flag.FlagSet, name, usage string, field any) error {
+	switch field := field.(type) {
+	case *string:
+		fs.StringVar(field, name, *field, usage)
+	case *int:
+		fs.IntVar(field, name, *field, usage)
+	case *int64:
+		fs.Int64Var(field, name, *field, usage)
+	case *bool:
+		fs.BoolVar(field, name, *field, usage)
+	case *time.Duration:
+		fs.DurationVar(field, name, *field, usage)
+	case *[]string:
+		fs.Var((*listValue)(field), name, usage)
+	default:
+		return fmt.Errorf("unsupported type of option %s: %T", name, field)
+	}
+	return nil
+}
+
+// listValue is comma separated list flag. Empty string sets empty list.
+type listValue []string
+
+func (l *listValue) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *listValue) Set(val string) error {
+	*l = nil
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// Validate checks that configuration can be used to start application. All found problems are returned.
+func (c *Config) Validate() error {
+	var errs []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+	_, err := zapcore.ParseLevel(c.Log.Level)
+	check(err == nil, "unknown log level: %s", c.Log.Level)
+	check(c.Server.Port != "", "port should be set")
+	check(c.Server.BodyLimit > 0, "body limit should be positive: %d", c.Server.BodyLimit)
+	if c.Server.AdminAddr != "" {
+		_, _, err := net.SplitHostPort(c.Server.AdminAddr)
+		check(err == nil, "invalid admin address: %s", c.Server.AdminAddr)
+	}
+
+	o := c.Orchestrator
+	u, err := url.Parse(o.ImageHost)
+	check(err == nil && u.Host != "" && (u.Scheme == "http" || u.Scheme == "https"), "invalid image host: %s", o.ImageHost)
+	check(o.MaxSyncRequests > 0, "max sync requests should be positive: %d", o.MaxSyncRequests)
+	check(o.MaxAsyncRequests > 0, "max async requests should be positive: %d", o.MaxAsyncRequests)
+	check(o.MaxQueueSize > 0, "max queue size should be positive: %d", o.MaxQueueSize)
+	check(o.MaxClientSyncRequests > 0 && o.MaxClientSyncRequests <= o.MaxSyncRequests,
+		"max client sync requests should be in range 1-%d: %d", o.MaxSyncRequests, o.MaxClientSyncRequests)
+	check(o.MaxClientAsyncRequests > 0 && o.MaxClientAsyncRequests <= o.MaxAsyncRequests,
+		"max client async requests should be in range 1-%d: %d", o.MaxAsyncRequests, o.MaxClientAsyncRequests)
+	check(o.MaxClientQueueSize > 0 && o.MaxClientQueueSize <= o.MaxQueueSize,
+		"max client queue size should be in range 1-%d: %d", o.MaxQueueSize, o.MaxClientQueueSize)
+	check(o.TaskTimeout > 0, "task timeout should be positive: %s", o.TaskTimeout)
+	check(o.ImageWaitTimeout > 0, "image wait timeout should be positive: %s", o.ImageWaitTimeout)
+
+	check(c.Fetch.MaxSize > 0, "fetch max size should be positive: %d", c.Fetch.MaxSize)
+	for _, scheme := range c.Fetch.AllowedSchemes {
+		check(scheme == "http" || scheme == "https", "unsupported fetch scheme: %s", scheme)
+	}
+	for _, network := range c.Fetch.AllowedNetworks {
+		_, err = netip.ParsePrefix(network)
+		check(err == nil, "invalid fetch allowed network: %s", network)
+	}
+	r := c.Fetch.Retry
+	check(r.MaxAttempts > 0, "fetch attempts should be positive: %d", r.MaxAttempts)
+	check(r.InitialBackoff > 0 && r.MaxBackoff >= r.InitialBackoff, "invalid fetch backoff: %s-%s", r.InitialBackoff, r.MaxBackoff)
+	check(r.MaxRetryAfter >= 0, "fetch max retry after should not be negative: %s", r.MaxRetryAfter)
+	for _, class := range r.Classes {
+		_, err = entities.ParseFetchErrorClass(class)
+		check(err == nil, "%v", err)
+	}
+	cl := c.Fetch.Client
+	check(cl.Timeout > 0 && cl.DialTimeout > 0 && cl.TLSHandshakeTimeout > 0 && cl.ResponseHeaderTimeout > 0 && cl.IdleConnTimeout > 0,
+		"fetch client timeouts should be positive")
+	check(cl.MaxIdleConns >= 0 && cl.MaxIdleConnsPerHost >= 0 && cl.MaxConnsPerHost >= 0,
+		"fetch client connection limits should not be negative")
+	check(cl.MaxRedirects > 0, "fetch max redirects should be positive: %d", cl.MaxRedirects)
+
+	switch c.Cache.Type {
+	case "memory", "disk", "redis", "s3":
+	default:
+		errs = append(errs, fmt.Sprintf("unknown cache type: %s", c.Cache.Type))
+	}
+	check(c.Cache.Size > 0, "cache size should be positive: %d", c.Cache.Size)
+	check(c.Cache.SourceSize >= 0, "source cache size should not be negative: %d", c.Cache.SourceSize)
+	check(c.Cache.SourceTTL >= 0, "source cache ttl should not be negative: %s", c.Cache.SourceTTL)
+	check(c.Cache.Redis.Timeout > 0, "redis timeout should be positive: %s", c.Cache.Redis.Timeout)
+	check(c.Cache.S3.Timeout > 0, "s3 timeout should be positive: %s", c.Cache.S3.Timeout)
+	check(!c.Webhook.Enabled || c.Webhook.Secret != "", "webhook secret should be set when callbacks are enabled")
+	w := c.Webhook
+	check(w.Attempts > 0, "webhook attempts should be positive: %d", w.Attempts)
+	check(w.InitialBackoff > 0 && w.MaxBackoff >= w.InitialBackoff, "invalid webhook backoff: %s-%s", w.InitialBackoff, w.MaxBackoff)
+	check(w.Timeout > 0, "webhook timeout should be positive: %s", w.Timeout)
+	for _, network := range w.AllowedNetworks {
+		_, err = netip.ParsePrefix(network)
+		check(err == nil, "invalid webhook allowed network: %s", network)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
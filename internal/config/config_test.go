@@ -0,0 +1,117 @@
+package config_test
+
+import (
+	"interview-fm-backend/internal/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		val, ok := vars[name]
+		return val, ok
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("should return defaults", func(t *testing.T) {
+		cfg, err := config.Load(nil, env(nil))
+		require.NoError(t, err)
+		require.Equal(t, config.Default(), cfg)
+	})
+	t.Run("should apply file, env and flags in order", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(file, []byte(`
+server:
+  port: "9000"
+orchestrator:
+  max_sync_requests: 20
+  max_async_requests: 30
+  task_timeout: 20s
+cache:
+  type: redis
+  redis:
+    addr: redis:6379
+`), 0o600))
+
+		cfg, err := config.Load([]string{"-config", file, "-maxasyncrequests", "40"}, env(map[string]string{
+			"MAX_SYNC_REQUESTS":   "25",
+			"MAX_ASYNC_REQUESTS":  "35",
+			"REDIS_PASSWORD":      "secret",
+			"FETCH_ALLOWED_HOSTS": "example.com, .cdn.org",
+		}))
+		require.NoError(t, err)
+		require.Equal(t, "9000", cfg.Server.Port)
+		require.Equal(t, 25, cfg.Orchestrator.MaxSyncRequests)
+		require.Equal(t, 40, cfg.Orchestrator.MaxAsyncRequests)
+		require.Equal(t, 20*time.Second, cfg.Orchestrator.TaskTimeout)
+		require.Equal(t, "redis", cfg.Cache.Type)
+		require.Equal(t, "redis:6379", cfg.Cache.Redis.Addr)
+		require.Equal(t, "secret", cfg.Cache.Redis.Password)
+		require.Equal(t, config.Default().Cache.Redis.Prefix, cfg.Cache.Redis.Prefix)
+		require.Equal(t, []string{"example.com", ".cdn.org"}, cfg.Fetch.AllowedHosts)
+	})
+	t.Run("should read file from env", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(file, []byte("server:\n  port: \"9000\"\n"), 0o600))
+		cfg, err := config.Load(nil, env(map[string]string{"CONFIG_FILE": file}))
+		require.NoError(t, err)
+		require.Equal(t, "9000", cfg.Server.Port)
+	})
+	t.Run("should fail on unknown keys", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(file, []byte("server:\n  prot: \"9000\"\n"), 0o600))
+		_, err := config.Load([]string{"-config", file}, env(nil))
+		require.ErrorContains(t, err, "field prot not found")
+
+		require.NoError(t, os.WriteFile(file, nil, 0o600))
+		_, err = config.Load([]string{"-config", file}, env(nil))
+		require.NoError(t, err)
+	})
+	t.Run("should fail on invalid values", func(t *testing.T) {
+		_, err := config.Load(nil, env(map[string]string{"TASK_TIMEOUT": "soon"}))
+		require.ErrorContains(t, err, "TASK_TIMEOUT")
+
+		_, err = config.Load([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, env(nil))
+		require.Error(t, err)
+
+		_, err = config.Load([]string{"-maxsyncrequests", "0", "-cache", "tape"}, env(nil))
+		require.ErrorContains(t, err, "max sync requests should be positive")
+		require.ErrorContains(t, err, "unknown cache type: tape")
+
+		_, err = config.Load([]string{"-fetchallowednetworks", "10.0.0.0/33", "-fetchallowedschemes", "file"}, env(nil))
+		require.ErrorContains(t, err, "invalid fetch allowed network: 10.0.0.0/33")
+		require.ErrorContains(t, err, "unsupported fetch scheme: file")
+
+		_, err = config.Load([]string{"-fetchdialtimeout", "0s", "-fetchmaxconnsperhost", "-1"}, env(map[string]string{"FETCH_MAX_REDIRECTS": "0"}))
+		require.ErrorContains(t, err, "fetch client timeouts should be positive")
+		require.ErrorContains(t, err, "fetch client connection limits should not be negative")
+		require.ErrorContains(t, err, "fetch max redirects should be positive: 0")
+
+		_, err = config.Load([]string{"-webhook"}, env(nil))
+		require.ErrorContains(t, err, "webhook secret should be set when callbacks are enabled")
+		_, err = config.Load([]string{"-webhook"}, env(map[string]string{"WEBHOOK_SECRET": "secret"}))
+		require.NoError(t, err)
+
+		_, err = config.Load([]string{"-webhookbackoff", "1m", "-webhookmaxbackoff", "1s", "-webhooktimeout", "0s"}, env(nil))
+		require.ErrorContains(t, err, "invalid webhook backoff: 1m0s-1s")
+		require.ErrorContains(t, err, "webhook timeout should be positive: 0s")
+
+		_, err = config.Load([]string{"-redistimeout", "0s"}, env(map[string]string{"S3_TIMEOUT": "-1s"}))
+		require.ErrorContains(t, err, "redis timeout should be positive: 0s")
+		require.ErrorContains(t, err, "s3 timeout should be positive: -1s")
+
+		_, err = config.Load([]string{"-adminaddr", "9090"}, env(nil))
+		require.ErrorContains(t, err, "invalid admin address: 9090")
+
+		_, err = config.Load([]string{"-loglevel", "loud"}, env(nil))
+		require.ErrorContains(t, err, "unknown log level: loud")
+
+		_, err = config.Load(nil, env(map[string]string{"CLIENT_QUEUE_SIZE": "2000"}))
+		require.ErrorContains(t, err, "max client queue size should be in range 1-1000")
+	})
+}
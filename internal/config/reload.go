@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Change is difference of setting between running and loaded configuration.
+type Change struct {
+	Key     string // path of setting in YAML file, like `orchestrator.max_sync_requests`
+	Old     string
+	New     string
+	Applied bool // false if setting can't be changed without restart
+}
+
+// Reload compares running configuration with loaded one. Returned configuration is running one,
+// where settings tagged by `reload` are replaced by loaded values, other settings require restart to be changed.
+// Values of secrets are not shown in changes.
+func Reload(current, loaded Config) (Config, []Change) {
+	var changes []Change
+	diff(reflect.ValueOf(&current).Elem(), reflect.ValueOf(loaded), "", &changes)
+	return current, changes
+}
+
+func diff(current, loaded reflect.Value, prefix string, changes *[]Change) {
+	for i := 0; i < current.NumField(); i++ {
+		field := current.Type().Field(i)
+		key := prefix + field.Tag.Get("yaml")
+		if field.Type.Kind() == reflect.Struct {
+			diff(current.Field(i), loaded.Field(i), key+".", changes)
+			continue
+		}
+		oldVal, newVal := current.Field(i), loaded.Field(i)
+		if reflect.DeepEqual(oldVal.Interface(), newVal.Interface()) {
+			continue
+		}
+		change := Change{
+			Key:     key,
+			Old:     fmt.Sprint(oldVal.Interface()),
+			New:     fmt.Sprint(newVal.Interface()),
+			Applied: field.Tag.Get("reload") == "true",
+		}
+		if field.Tag.Get("secret") == "true" {
+			change.Old, change.New = "***", "***"
+		}
+		if change.Applied {
+			oldVal.Set(newVal)
+		}
+		*changes = append(*changes, change)
+	}
+}
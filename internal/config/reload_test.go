@@ -0,0 +1,41 @@
+package config_test
+
+import (
+	"interview-fm-backend/internal/config"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	current := config.Default()
+	loaded := config.Default()
+	loaded.Log.Level = "debug"
+	loaded.Orchestrator.MaxSyncRequests = 20
+	loaded.Fetch.AllowedHosts = []string{"example.com"}
+	loaded.Server.Port = "9000"
+	loaded.Webhook.Secret = "secret"
+
+	applied, changes := config.Reload(current, loaded)
+	require.Equal(t, []config.Change{
+		{Key: "log.level", Old: "info", New: "debug", Applied: true},
+		{Key: "server.port", Old: "8080", New: "9000"},
+		{Key: "orchestrator.max_sync_requests", Old: "10", New: "20", Applied: true},
+		{Key: "fetch.allowed_hosts", Old: "[]", New: "[example.com]", Applied: true},
+		{Key: "webhook.secret", Old: "***", New: "***"},
+	}, changes)
+
+	expected := config.Default()
+	expected.Log.Level = "debug"
+	expected.Orchestrator.MaxSyncRequests = 20
+	expected.Fetch.AllowedHosts = []string{"example.com"}
+	require.Equal(t, expected, applied)
+	// running config is not changed
+	require.Equal(t, config.Default(), current)
+
+	_, changes = config.Reload(applied, loaded)
+	require.Equal(t, []config.Change{
+		{Key: "server.port", Old: "8080", New: "9000"},
+		{Key: "webhook.secret", Old: "***", New: "***"},
+	}, changes)
+}
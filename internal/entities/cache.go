@@ -4,3 +4,15 @@ type CacheItem struct {
 	Key string
 	Val []byte
 }
+
+// CacheStats describes current cache usage.
+type CacheStats struct {
+	Items     int    `json:"items"`
+	Bytes     int64  `json:"bytes"`
+	MaxBytes  int64  `json:"max_bytes"`
+	Evictions uint64 `json:"evictions"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+
+	Tiers map[string]CacheStats `json:"tiers,omitempty"` // usage of each tier for multi tier caches
+}
@@ -0,0 +1,39 @@
+package entities
+
+import "fmt"
+
+// FetchErrorClass groups fetch failures, retry policy is set for each class.
+type FetchErrorClass string
+
+const (
+	FetchErrorClassNetwork   FetchErrorClass = "network"   // connection failed or broken
+	FetchErrorClassTimeout   FetchErrorClass = "timeout"   // request timed out, including 408 status
+	FetchErrorClassThrottled FetchErrorClass = "throttled" // 429 and 503 statuses, server can set delay by `Retry-After`
+	FetchErrorClassServer    FetchErrorClass = "server"    // other 5xx statuses
+	FetchErrorClassClient    FetchErrorClass = "client"    // other non-200 statuses
+	FetchErrorClassInvalid   FetchErrorClass = "invalid"   // url or response can't be used, like too big image
+	FetchErrorClassForbidden FetchErrorClass = "forbidden" // url or its address is blocked by fetch rules
+)
+
+var fetchErrorClasses = []FetchErrorClass{
+	FetchErrorClassNetwork, FetchErrorClassTimeout, FetchErrorClassThrottled, FetchErrorClassServer, FetchErrorClassClient,
+	FetchErrorClassInvalid, FetchErrorClassForbidden,
+}
+
+// ParseFetchErrorClass returns class by its name.
+func ParseFetchErrorClass(name string) (FetchErrorClass, error) {
+	for _, class := range fetchErrorClasses {
+		if string(class) == name {
+			return class, nil
+		}
+	}
+	return "", fmt.Errorf("unknown fetch error class: %s", name)
+}
+
+// FetchHostStats describes connections to source image host.
+type FetchHostStats struct {
+	Requests    uint64 `json:"requests"`     // requests sent to host, including retries and redirects
+	NewConns    uint64 `json:"new_conns"`    // connections dialed to host
+	ReusedConns uint64 `json:"reused_conns"` // requests sent over idle connection from pool
+	OpenConns   int64  `json:"open_conns"`   // connections currently open, both active and idle
+}
@@ -0,0 +1,63 @@
+package entities
+
+import (
+	"fmt"
+	"time"
+)
+
+// Priority is queue lane of async request. Lanes share processing slots by weight, so low priority is not starved.
+type Priority string
+
+const (
+	PriorityDefault Priority = "" // same as PriorityNormal
+	PriorityLow     Priority = "low"
+	PriorityNormal  Priority = "normal"
+	PriorityHigh    Priority = "high"
+)
+
+// Validate checks that priority is supported.
+func (p Priority) Validate() error {
+	switch p {
+	case PriorityDefault, PriorityLow, PriorityNormal, PriorityHigh:
+		return nil
+	}
+	return fmt.Errorf("unsupported priority: %s", p)
+}
+
+// ResizeResponse is result of resize request. JobID is set only for async processing.
+type ResizeResponse struct {
+	JobID   string
+	Results []ResizeResult
+}
+
+// JobStatus describes progress of async resize request.
+type JobStatus struct {
+	ID        string             `json:"id"`
+	Status    ResizeResultStatus `json:"status"` // processing until all images are done, failure if any image failed
+	CreatedAt time.Time          `json:"created_at"`
+	Images    []JobImageStatus   `json:"images"`
+}
+
+type JobImageStatus struct {
+	SourceURL     string             `json:"source_url"`
+	URL           string             `json:"url,omitempty"`
+	Result        ResizeResultStatus `json:"result"`
+	Error         string             `json:"error,omitempty"`
+	Attempts      int                `json:"attempts,omitempty"`       // downloads of source image, including retries
+	QueuePosition int                `json:"queue_position,omitempty"` // 1 based position in queue, empty when processing started
+	QueuedAt      *time.Time         `json:"queued_at,omitempty"`
+	StartedAt     *time.Time         `json:"started_at,omitempty"`
+	FinishedAt    *time.Time         `json:"finished_at,omitempty"`
+}
+
+// QueueStats describes current usage of async queue.
+type QueueStats struct {
+	Depth      int    `json:"depth"` // tasks waiting in queue
+	Capacity   int    `json:"capacity"`
+	Processing int    `json:"processing"` // tasks being processed now
+	Rejected   uint64 `json:"rejected"`   // requests rejected because queue was full
+	Coalesced  uint64 `json:"coalesced"`  // sync and async images served by identical processing already in progress
+	Waiting    int    `json:"waiting"`    // sync and async images waiting for identical processing in progress
+
+	Lanes map[Priority]int `json:"lanes"` // tasks waiting in each priority lane
+}
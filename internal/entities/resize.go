@@ -1,5 +1,13 @@
 package entities
 
+import (
+	"fmt"
+	"image/color"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
 type ResizeResultStatus string
 
 const (
@@ -8,14 +16,282 @@ const (
 	ResizeResultStatusProcessing ResizeResultStatus = "processing"
 )
 
+// ImageFormat is the name of image encoding, same as registered in `image` package decoders.
+type ImageFormat string
+
+const (
+	ImageFormatJPEG ImageFormat = "jpeg"
+	ImageFormatPNG  ImageFormat = "png"
+	ImageFormatGIF  ImageFormat = "gif"
+	ImageFormatWebP ImageFormat = "webp"
+)
+
+// Extension returns file extension used in image urls.
+func (f ImageFormat) Extension() string {
+	switch f {
+	case ImageFormatJPEG:
+		return "jpg"
+	case ImageFormatPNG, ImageFormatGIF, ImageFormatWebP:
+		return string(f)
+	}
+	return "jpg"
+}
+
+// ContentType returns mime type of image format.
+func (f ImageFormat) ContentType() string {
+	switch f {
+	case ImageFormatJPEG, ImageFormatPNG, ImageFormatGIF, ImageFormatWebP:
+		return "image/" + string(f)
+	}
+	return "application/octet-stream"
+}
+
+// OutputFormat is format requested by client. Empty value means keep source image format.
+type OutputFormat string
+
+const (
+	OutputFormatSource       OutputFormat = ""
+	OutputFormatJPEG         OutputFormat = "jpeg"
+	OutputFormatPNG          OutputFormat = "png"
+	OutputFormatWebPLossless OutputFormat = "webp-lossless"
+)
+
+// ImageFormat returns encoding for requested output format.
+func (f OutputFormat) ImageFormat() (ImageFormat, error) {
+	switch f {
+	case OutputFormatSource:
+		return "", nil
+	case OutputFormatJPEG:
+		return ImageFormatJPEG, nil
+	case OutputFormatPNG:
+		return ImageFormatPNG, nil
+	case OutputFormatWebPLossless:
+		return ImageFormatWebP, nil
+	}
+	return "", fmt.Errorf("unsupported output format: %s", f)
+}
+
+const MaxQuality = 100
+
+// ResizeMode describes how image is fitted into requested width and height.
+type ResizeMode string
+
+const (
+	ResizeModeStretch ResizeMode = ""     // exact width and height, aspect ratio is kept only if one of dimensions is 0
+	ResizeModeFit     ResizeMode = "fit"  // fit into bounding box, keeping aspect ratio
+	ResizeModeFill    ResizeMode = "fill" // cover bounding box, keeping aspect ratio, than crop by gravity
+	ResizeModePad     ResizeMode = "pad"  // fit into bounding box and letterbox with background color
+)
+
+// resizeModeStretchAlias is accepted in requests as explicit name of ResizeModeStretch.
+const resizeModeStretchAlias = "stretch"
+
+// normalize returns mode with alias replaced by mode it names.
+func (m ResizeMode) normalize() ResizeMode {
+	if m == resizeModeStretchAlias {
+		return ResizeModeStretch
+	}
+	return m
+}
+
+// Gravity describes which part of image is kept on crop or where image is placed on pad.
+type Gravity string
+
+const (
+	GravityCenter    Gravity = ""
+	GravityNorth     Gravity = "north"
+	GravitySouth     Gravity = "south"
+	GravityEast      Gravity = "east"
+	GravityWest      Gravity = "west"
+	GravityNorthEast Gravity = "northeast"
+	GravityNorthWest Gravity = "northwest"
+	GravitySouthEast Gravity = "southeast"
+	GravitySouthWest Gravity = "southwest"
+)
+
+// Position returns relative position of gravity, where 0 is top or left edge and 2 is bottom or right edge.
+func (g Gravity) Position() (x, y int, err error) {
+	switch g {
+	case GravityCenter:
+		return 1, 1, nil
+	case GravityNorth:
+		return 1, 0, nil
+	case GravitySouth:
+		return 1, 2, nil
+	case GravityEast:
+		return 2, 1, nil
+	case GravityWest:
+		return 0, 1, nil
+	case GravityNorthEast:
+		return 2, 0, nil
+	case GravityNorthWest:
+		return 0, 0, nil
+	case GravitySouthEast:
+		return 2, 2, nil
+	case GravitySouthWest:
+		return 0, 2, nil
+	}
+	return 0, 0, fmt.Errorf("unsupported gravity: %s", g)
+}
+
+// Interpolation is kernel used for resampling, faster kernels give lower quality.
+type Interpolation string
+
+const (
+	InterpolationDefault           Interpolation = "" // same as InterpolationLanczos3
+	InterpolationNearestNeighbor   Interpolation = "nearest-neighbor"
+	InterpolationBilinear          Interpolation = "bilinear"
+	InterpolationBicubic           Interpolation = "bicubic"
+	InterpolationMitchellNetravali Interpolation = "mitchell-netravali"
+	InterpolationLanczos2          Interpolation = "lanczos2"
+	InterpolationLanczos3          Interpolation = "lanczos3"
+)
+
+// Validate checks that interpolation is supported.
+func (i Interpolation) Validate() error {
+	switch i {
+	case InterpolationDefault, InterpolationNearestNeighbor, InterpolationBilinear, InterpolationBicubic,
+		InterpolationMitchellNetravali, InterpolationLanczos2, InterpolationLanczos3:
+		return nil
+	}
+	return fmt.Errorf("unsupported interpolation: %s", i)
+}
+
+// DefaultBackground is used by pad mode, when background is not set.
+const DefaultBackground = "ffffff"
+
+// ParseHexColor parses color in `RRGGBB` or `RRGGBBAA` form, leading `#` is optional.
+func ParseHexColor(src string) (color.NRGBA, error) {
+	src = strings.TrimPrefix(src, "#")
+	if len(src) != 6 && len(src) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color: %s", src)
+	}
+	if len(src) == 6 {
+		src += "ff"
+	}
+	val, err := strconv.ParseUint(src, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color: %s", src)
+	}
+	return color.NRGBA{R: uint8(val >> 24), G: uint8(val >> 16), B: uint8(val >> 8), A: uint8(val)}, nil
+}
+
 type ResizeRequest struct {
-	URLs   []string `json:"urls"`
-	Width  uint     `json:"width"`
-	Height uint     `json:"height"`
+	URLs    []string     `json:"urls"`
+	Width   uint         `json:"width"`
+	Height  uint         `json:"height"`
+	Format  OutputFormat `json:"format,omitempty"`
+	Quality int          `json:"quality,omitempty"` // 1-100, applied to requested jpeg only. 0 means encoder default
+
+	Mode       ResizeMode `json:"mode,omitempty"`
+	Gravity    Gravity    `json:"gravity,omitempty"`    // used by fill and pad modes
+	Background string     `json:"background,omitempty"` // hex color used by pad mode
+
+	Interpolation Interpolation `json:"interpolation,omitempty"`
+
+	CallbackURL string   `json:"callback_url,omitempty"` // results of async request are posted to it, when all images are done
+	Priority    Priority `json:"priority,omitempty"`     // queue lane of async request, ignored by sync requests
+
+	// Revalidate checks sources of cached images by conditional requests, even if they are not expired.
+	// Changed images are resized again.
+	Revalidate bool `json:"revalidate,omitempty"`
+
+	ClientID string `json:"-"` // identity of client, set by router. Images of different clients are scheduled fairly
+}
+
+// Validate checks that request parameters are supported.
+func (r *ResizeRequest) Validate() error {
+	if _, err := r.Format.ImageFormat(); err != nil {
+		return err
+	}
+	if r.Quality < 0 || r.Quality > MaxQuality {
+		return fmt.Errorf("quality should be in range 1-%d", MaxQuality)
+	}
+	switch r.Mode.normalize() {
+	case ResizeModeStretch, ResizeModeFit:
+	case ResizeModeFill, ResizeModePad:
+		if r.Width == 0 || r.Height == 0 {
+			return fmt.Errorf("mode %s requires both width and height", r.Mode)
+		}
+	default:
+		return fmt.Errorf("unsupported mode: %s", r.Mode)
+	}
+	if _, _, err := r.Gravity.Position(); err != nil {
+		return err
+	}
+	if err := r.Interpolation.Validate(); err != nil {
+		return err
+	}
+	if r.Background != "" {
+		if _, err := ParseHexColor(r.Background); err != nil {
+			return err
+		}
+	}
+	if err := r.Priority.Validate(); err != nil {
+		return err
+	}
+	if r.CallbackURL != "" {
+		u, err := url.Parse(r.CallbackURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid callback url: %s", r.CallbackURL)
+		}
+	}
+	return nil
+}
+
+// Params returns resize parameters of request. Request should be validated before.
+func (r *ResizeRequest) Params() ResizeParams {
+	format, _ := r.Format.ImageFormat()
+	mode := r.Mode.normalize()
+	params := ResizeParams{
+		Width:   r.Width,
+		Height:  r.Height,
+		Format:  format,
+		Quality: r.Quality,
+		Mode:    mode,
+	}
+	if r.Interpolation != InterpolationLanczos3 {
+		params.Interpolation = r.Interpolation
+	}
+	// quality is used by jpeg encoder only. Format of source is unknown, when key of image is generated,
+	// so quality is applied only to requested jpeg and is dropped for other formats to not produce different cache keys
+	if format != ImageFormatJPEG {
+		params.Quality = 0
+	}
+	// gravity and background are not used by other modes, so they are dropped to not produce different cache keys
+	switch mode {
+	case ResizeModePad:
+		params.Background = strings.ToLower(strings.TrimPrefix(r.Background, "#"))
+		if params.Background == DefaultBackground {
+			params.Background = ""
+		}
+		params.Gravity = r.Gravity
+	case ResizeModeFill:
+		params.Gravity = r.Gravity
+	case ResizeModeStretch, ResizeModeFit:
+	}
+	return params
+}
+
+// ResizeParams describes how single image should be resized and encoded.
+type ResizeParams struct {
+	Width   uint
+	Height  uint
+	Format  ImageFormat // empty means same format as source image
+	Quality int         // 0 means encoder default
+
+	Mode       ResizeMode
+	Gravity    Gravity
+	Background string // hex color without `#`, empty means DefaultBackground
+
+	Interpolation Interpolation
 }
 
 type ResizeResult struct {
 	Result ResizeResultStatus `json:"result"`
 	URL    string             `json:"url,omitempty"`
 	Cached bool               `json:"cached"`
+	Error  string             `json:"error,omitempty"` // failure reason
+
+	Attempts int `json:"attempts,omitempty"` // downloads of source image, including retries. Empty if image was cached
 }
@@ -6,7 +6,8 @@ import (
 )
 
 type Logger struct {
-	l *zap.Logger
+	l     *zap.Logger
+	level zap.AtomicLevel // shared by all derived loggers
 }
 
 func NewAppLogger() (*Logger, error) {
@@ -20,7 +21,18 @@ func NewAppLogger() (*Logger, error) {
 		return nil, err
 	}
 
-	return &Logger{l: z}, nil
+	return &Logger{l: z, level: cnf.Level}, nil
+}
+
+// SetLevel changes minimal level of logged messages, like `debug`, `info` or `error`.
+// Loggers created by With are affected too.
+func (a Logger) SetLevel(level string) error {
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	a.level.SetLevel(lvl)
+	return nil
 }
 
 func (a Logger) Info(message string, args ...zapcore.Field) {
@@ -44,7 +56,7 @@ func (a Logger) Fatal(message string, err error, args ...zapcore.Field) {
 }
 
 func (a Logger) With(arg zapcore.Field) AppLogger {
-	return Logger{l: a.l.With(arg)}
+	return Logger{l: a.l.With(arg), level: a.level}
 }
 
 func prepareParams(err error, args []zapcore.Field) []zapcore.Field {
@@ -0,0 +1,41 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/expvar"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+)
+
+// AdminRouter serves internal endpoints, like metrics on /debug/vars.
+// It listens on separate address, which should not be reachable by clients.
+type AdminRouter struct {
+	addr     string
+	fiberApp *fiber.App
+}
+
+// InitAdminRouter initializes the admin router.
+func InitAdminRouter(addr string) *AdminRouter {
+	fiberApp := fiber.New(
+		fiber.Config{
+			DisableStartupMessage: true,
+		},
+	)
+
+	fiberApp.Use(recover.New())
+	fiberApp.Use(expvar.New()) // serves metrics on /debug/vars
+
+	return &AdminRouter{
+		addr:     addr,
+		fiberApp: fiberApp,
+	}
+}
+
+// Run starts the server.
+func (a *AdminRouter) Run() error {
+	return a.fiberApp.Listen(a.addr)
+}
+
+// Shutdown gracefully shuts down the server.
+func (a *AdminRouter) Shutdown() error {
+	return a.fiberApp.Shutdown()
+}
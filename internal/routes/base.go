@@ -1,34 +1,47 @@
 package routes
 
 import (
+	"context"
 	"interview-fm-backend/internal/service/orchestrator"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 )
 
+// HeaderAPIKey identifies client, images of different clients are scheduled fairly.
+const HeaderAPIKey = "X-API-Key"
+
+type Config struct {
+	Port      string
+	BodyLimit int // max size of request body in bytes
+}
+
 type AppRouter struct {
 	service  orchestrator.Orchestrator
 	appPort  string
 	fiberApp *fiber.App
+
+	streamsCtx    context.Context // canceled on shutdown to close event streams, which otherwise keep connections busy
+	streamsCancel context.CancelFunc
 }
 
 // InitAppRouter initializes the app router.
-func InitAppRouter(appPort string, service orchestrator.Orchestrator) *AppRouter {
+func InitAppRouter(cfg Config, service orchestrator.Orchestrator) *AppRouter {
 	fiberApp := fiber.New(
 		fiber.Config{
 			DisableStartupMessage: true,
-			BodyLimit:             8 * 1024,
+			BodyLimit:             cfg.BodyLimit,
 		},
 	)
 
 	fiberApp.Use(recover.New())
 
 	app := &AppRouter{
-		appPort:  appPort,
+		appPort:  cfg.Port,
 		fiberApp: fiberApp,
 		service:  service,
 	}
+	app.streamsCtx, app.streamsCancel = context.WithCancel(context.Background())
 	app.initRoutes()
 	return app
 }
@@ -38,7 +51,9 @@ func (a *AppRouter) initRoutes() {
 		return ctx.SendString("pong")
 	})
 	a.fiberApp.Post("/v1/resize", a.resize)
-	a.fiberApp.Get("/v1/image/:image.jpg", a.getImage)
+	a.fiberApp.Get("/v1/image/:image.:ext", a.getImage)
+	a.fiberApp.Get("/v1/jobs/:id", a.getJob)
+	a.fiberApp.Get("/v1/jobs/:id/events", a.jobEvents)
 }
 
 // Run starts the server.
@@ -48,5 +63,6 @@ func (a *AppRouter) Run() error {
 
 // Shutdown gracefully shuts down the server.
 func (a *AppRouter) Shutdown() error {
+	a.streamsCancel()
 	return a.fiberApp.Shutdown()
 }
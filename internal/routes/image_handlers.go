@@ -1,25 +1,49 @@
 package routes
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"interview-fm-backend/internal/entities"
+	"interview-fm-backend/internal/service/orchestrator"
+	"interview-fm-backend/internal/service/webhook"
+	"interview-fm-backend/internal/utils"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func (a *AppRouter) resize(ctx *fiber.Ctx) error {
 	var resizeRequest *entities.ResizeRequest
-	if err := ctx.BodyParser(&resizeRequest); err != nil {
+	if err := ctx.BodyParser(&resizeRequest); err != nil || resizeRequest == nil {
 		return fiber.ErrBadRequest
 	}
+	if err := resizeRequest.Validate(); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	resizeRequest.ClientID = clientID(ctx)
 	var asyncProcess bool
 	if ctx.Query("async") == "true" {
 		asyncProcess = true
 	}
 	response, err := a.service.ProcessResizes(ctx.UserContext(), resizeRequest, asyncProcess)
+	if errors.Is(err, orchestrator.ErrQueueFull) || errors.Is(err, orchestrator.ErrClientQueueFull) {
+		ctx.Set(fiber.HeaderRetryAfter, "1")
+		return fiber.NewError(fiber.StatusTooManyRequests, err.Error())
+	}
+	if errors.Is(err, webhook.ErrCallbackNotAllowed) {
+		return fiber.NewError(fiber.StatusBadRequest, webhook.ErrCallbackNotAllowed.Error())
+	}
+	if errors.Is(err, orchestrator.ErrCallbacksDisabled) {
+		return fiber.NewError(fiber.StatusBadRequest, orchestrator.ErrCallbacksDisabled.Error())
+	}
 	if err != nil {
 		return fiber.ErrInternalServerError
 	}
-	return ctx.JSON(response)
+	if response.JobID != "" {
+		ctx.Set("X-Job-Id", response.JobID)
+		ctx.Location("/v1/jobs/" + response.JobID)
+	}
+	return ctx.JSON(response.Results)
 }
 
 func (a *AppRouter) getImage(ctx *fiber.Ctx) error {
@@ -30,6 +54,21 @@ func (a *AppRouter) getImage(ctx *fiber.Ctx) error {
 	if !ok {
 		return fiber.ErrNotFound
 	}
-	ctx.Set("Content-Type", "image/jpeg")
+	format, err := utils.DetectImageFormat(data)
+	if err != nil {
+		return fiber.ErrInternalServerError
+	}
+	ctx.Set("Content-Type", format.ContentType())
 	return ctx.Send(data)
 }
+
+// clientID returns identity of client by its API key. Key itself is not used, so it does not appear in logs and journal.
+// Requests without key are identified by remote address, so anonymous clients don't share quotas with each other.
+func clientID(ctx *fiber.Ctx) string {
+	key := ctx.Get(HeaderAPIKey)
+	if key == "" {
+		return "ip:" + ctx.IP()
+	}
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:8])
+}
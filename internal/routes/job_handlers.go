@@ -0,0 +1,95 @@
+package routes
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// heartbeatInterval is how often idle event stream is written to, so proxies don't close it and gone client is noticed.
+const heartbeatInterval = 15 * time.Second
+
+func (a *AppRouter) getJob(ctx *fiber.Ctx) error {
+	status, ok, err := a.service.GetJob(ctx.UserContext(), ctx.Params("id"))
+	if err != nil {
+		return fiber.ErrInternalServerError
+	}
+	if !ok {
+		return fiber.ErrNotFound
+	}
+	return ctx.JSON(status)
+}
+
+// jobEvents streams job progress as server-sent events.
+// `image` event is sent with current status of every image and again when image is done,
+// `done` event with job status is sent at the end of stream. Comment line is sent as heartbeat between events.
+func (a *AppRouter) jobEvents(ctx *fiber.Ctx) error {
+	jobID := ctx.Params("id")
+	// stream is written after handler returns, so it can't use request context
+	watchCtx, cancel := context.WithCancel(a.streamsCtx)
+	events, ok, err := a.service.WatchJob(watchCtx, jobID)
+	if err != nil {
+		cancel()
+		return fiber.ErrInternalServerError
+	}
+	if !ok {
+		cancel()
+		return fiber.ErrNotFound
+	}
+
+	ctx.Set("Content-Type", "text/event-stream")
+	ctx.Set("Cache-Control", "no-cache")
+	ctx.Set("Connection", "keep-alive")
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+	stream:
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					break stream
+				}
+				if err := writeEvent(w, "image", event); err != nil {
+					return // client is gone
+				}
+			case <-heartbeat.C:
+				if err := writeHeartbeat(w); err != nil {
+					return // client is gone
+				}
+			}
+		}
+		if watchCtx.Err() != nil {
+			return
+		}
+		status, ok, err := a.service.GetJob(watchCtx, jobID)
+		if err != nil || !ok {
+			return
+		}
+		_ = writeEvent(w, "done", status)
+	})
+	return nil
+}
+
+func writeEvent(w *bufio.Writer, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func writeHeartbeat(w *bufio.Writer) error {
+	if _, err := w.WriteString(":\n\n"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -1,8 +1,32 @@
 package fetch
 
-import "context"
+import (
+	"context"
+	"time"
+)
+
+// Validators identify version of source image. They are sent with conditional request,
+// so unchanged image is not downloaded again.
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+// Response is downloaded source image.
+type Response struct {
+	Data        []byte
+	Attempts    int  // requests made to download image, including retries
+	NotModified bool // image is not changed since validators of conditional request, data is empty
+	Validators  Validators
+	// ExpiresAt is when image should be revalidated by `max-age` of `Cache-Control` header.
+	// It is time of download for `no-cache` and `no-store` responses and zero if header has no limit.
+	ExpiresAt time.Time
+	NoStore   bool // `Cache-Control` forbids to store image
+}
 
 //go:generate mockgen -source=abstract.go -destination=abstract_fetch_mock.go -package=fetch
 type Fetcher interface {
-	Fetch(ctx context.Context, url string) ([]byte, error)
+	// Fetch downloads url. If validators are not empty, request is conditional and unchanged image is reported
+	// by NotModified. Failed download returns *Error with class of failure and count of attempts.
+	Fetch(ctx context.Context, url string, validators Validators) (Response, error)
 }
@@ -35,16 +35,16 @@ func (m *MockFetcher) EXPECT() *MockFetcherMockRecorder {
 }
 
 // Fetch mocks base method.
-func (m *MockFetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+func (m *MockFetcher) Fetch(ctx context.Context, url string, validators Validators) (Response, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Fetch", ctx, url)
-	ret0, _ := ret[0].([]byte)
+	ret := m.ctrl.Call(m, "Fetch", ctx, url, validators)
+	ret0, _ := ret[0].(Response)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Fetch indicates an expected call of Fetch.
-func (mr *MockFetcherMockRecorder) Fetch(ctx, url interface{}) *gomock.Call {
+func (mr *MockFetcherMockRecorder) Fetch(ctx, url, validators interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*MockFetcher)(nil).Fetch), ctx, url)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*MockFetcher)(nil).Fetch), ctx, url, validators)
 }
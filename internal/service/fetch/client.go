@@ -0,0 +1,188 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"interview-fm-backend/internal/entities"
+	"interview-fm-backend/internal/utils"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClientConfig tunes HTTP client shared by all fetches. Connection settings are applied on service creation,
+// MaxRedirects and UserAgent are read for each request and can be changed by SetConfig.
+type ClientConfig struct {
+	Timeout               time.Duration // total time of single download attempt, including body
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration // time to wait for response headers after request is sent
+	IdleConnTimeout       time.Duration // idle connections are closed after timeout
+	MaxIdleConns          int           // idle connections to all hosts
+	MaxIdleConnsPerHost   int           // idle connections kept for each host, so batch of images from one CDN reuses them
+	MaxConnsPerHost       int           // active and idle connections to each host, 0 means no limit
+	DisableHTTP2          bool
+	MaxRedirects          int // redirects followed before fetch fails, 0 means default 10
+	UserAgent             string
+}
+
+const defaultMaxRedirects = 10
+
+// maxStatsHosts limits hosts with connection metrics, least recently used host is dropped first.
+// Open connections of dropped host are not counted, if host is used again.
+const maxStatsHosts = 1000
+
+// hostCounters are connection metrics of single host.
+type hostCounters struct {
+	address  string
+	requests uint64
+	newConns uint64
+	reused   uint64
+	open     int64
+}
+
+// newClient creates client, which checks addresses at dial time and counts connections by host.
+func (s *Service) newClient(cfg ClientConfig) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: 30 * time.Second,
+		Control: utils.GuardedControl(func() []netip.Prefix {
+			return s.config().AllowedNetworks
+		}),
+	}
+	transport := &http.Transport{
+		Proxy: nil, // proxy would hide real destination from address check
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			counters := s.host(address)
+			atomic.AddUint64(&counters.newConns, 1)
+			atomic.AddInt64(&counters.open, 1)
+			return &countedConn{Conn: conn, open: &counters.open}, nil
+		},
+		ForceAttemptHTTP2:     !cfg.DisableHTTP2,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{
+		Transport:     &countingTransport{service: s, base: transport},
+		CheckRedirect: s.checkRedirect,
+		Timeout:       cfg.Timeout,
+	}
+}
+
+// Stats returns connection metrics by host, key is `host:port`. Only hosts with established connections are reported,
+// up to maxStatsHosts recently used ones.
+func (s *Service) Stats() map[string]entities.FetchHostStats {
+	s.hostsMU.Lock()
+	defer s.hostsMU.Unlock()
+	stats := make(map[string]entities.FetchHostStats, len(s.hosts))
+	for host, elem := range s.hosts {
+		counters, ok := elem.Value.(*hostCounters)
+		if !ok {
+			continue
+		}
+		stats[host] = entities.FetchHostStats{
+			Requests:    atomic.LoadUint64(&counters.requests),
+			NewConns:    atomic.LoadUint64(&counters.newConns),
+			ReusedConns: atomic.LoadUint64(&counters.reused),
+			OpenConns:   atomic.LoadInt64(&counters.open),
+		}
+	}
+	return stats
+}
+
+// host returns counters of host, it should be called only for established connections,
+// so hosts blocked by address check or unreachable ones don't take place in metrics.
+func (s *Service) host(address string) *hostCounters {
+	s.hostsMU.Lock()
+	defer s.hostsMU.Unlock()
+	if elem, ok := s.hosts[address]; ok {
+		s.hostsLRU.MoveToFront(elem)
+		if counters, ok := elem.Value.(*hostCounters); ok {
+			return counters
+		}
+	}
+	counters := &hostCounters{address: address}
+	s.hosts[address] = s.hostsLRU.PushFront(counters)
+	for s.hostsLRU.Len() > maxStatsHosts {
+		oldest := s.hostsLRU.Back()
+		s.hostsLRU.Remove(oldest)
+		if evicted, ok := oldest.Value.(*hostCounters); ok {
+			delete(s.hosts, evicted.address)
+		}
+	}
+	return counters
+}
+
+func (s *Service) checkRedirect(req *http.Request, via []*http.Request) error {
+	maxRedirects := s.config().Client.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+	if len(via) > maxRedirects {
+		return errors.New("too many redirects")
+	}
+	return checkURL(req.URL, s.config())
+}
+
+// countingTransport sets User-Agent and counts requests of each host, redirects are counted by their target host.
+// Requests are counted when connection is got, so requests blocked at dial time are not counted.
+type countingTransport struct {
+	service *Service
+	base    http.RoundTripper
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	address := hostAddress(req)
+	ctx := httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			counters := t.service.host(address)
+			atomic.AddUint64(&counters.requests, 1)
+			if info.Reused {
+				atomic.AddUint64(&counters.reused, 1)
+			}
+		},
+	})
+	req = req.Clone(ctx)
+	if userAgent := t.service.config().Client.UserAgent; userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// hostAddress returns `host:port` of request as it is passed to dialer.
+func hostAddress(req *http.Request) string {
+	if port := req.URL.Port(); port != "" {
+		return net.JoinHostPort(req.URL.Hostname(), port)
+	}
+	if req.URL.Scheme == "https" {
+		return net.JoinHostPort(req.URL.Hostname(), "443")
+	}
+	return net.JoinHostPort(req.URL.Hostname(), "80")
+}
+
+// countedConn decrements open connections of host on close.
+type countedConn struct {
+	net.Conn
+	open  *int64
+	close sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.close.Do(func() {
+		atomic.AddInt64(c.open, -1)
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,58 @@
+package fetch_test
+
+import (
+	"context"
+	"interview-fm-backend/internal/service/fetch"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Client(t *testing.T) {
+	userAgents := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/redirect", http.StatusFound)
+			return
+		}
+		userAgents <- r.UserAgent()
+		_, _ = w.Write([]byte("image"))
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	t.Run("should reuse connections to host", func(t *testing.T) {
+		service := fetch.NewService(fetch.Config{AllowedNetworks: localNetworks, MaxSize: 10, Client: fetch.ClientConfig{
+			MaxIdleConnsPerHost: 2,
+			UserAgent:           "resizer/1.0",
+		}})
+		for i := 0; i < 5; i++ {
+			_, err := service.Fetch(ctx, server.URL, fetch.Validators{})
+			require.NoError(t, err)
+			require.Equal(t, "resizer/1.0", <-userAgents)
+		}
+		stats := service.Stats()[host]
+		require.Equal(t, uint64(5), stats.Requests)
+		require.Equal(t, uint64(1), stats.NewConns)
+		require.Equal(t, uint64(4), stats.ReusedConns)
+		require.Equal(t, int64(1), stats.OpenConns)
+	})
+	t.Run("should limit redirects", func(t *testing.T) {
+		service := fetch.NewService(fetch.Config{AllowedNetworks: localNetworks, MaxSize: 10, Client: fetch.ClientConfig{
+			MaxRedirects: 2,
+		}})
+		_, err := service.Fetch(ctx, server.URL+"/redirect", fetch.Validators{})
+		require.ErrorContains(t, err, "too many redirects")
+		require.Equal(t, uint64(3), service.Stats()[host].Requests)
+	})
+	t.Run("should not count blocked hosts", func(t *testing.T) {
+		service := fetch.NewService(fetch.Config{MaxSize: 10})
+		_, err := service.Fetch(ctx, server.URL, fetch.Validators{})
+		require.ErrorIs(t, err, fetch.ErrAddressNotAllowed)
+		require.Empty(t, service.Stats())
+	})
+}
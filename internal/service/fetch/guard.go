@@ -0,0 +1,63 @@
+package fetch
+
+import (
+	"errors"
+	"fmt"
+	"interview-fm-backend/internal/utils"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrSchemeNotAllowed is returned when url scheme is not in allowlist.
+	ErrSchemeNotAllowed = errors.New("scheme is not allowed")
+	// ErrHostNotAllowed is returned when url host is not in allowlist or is in denylist.
+	ErrHostNotAllowed = errors.New("host is not allowed")
+	// ErrAddressNotAllowed is returned when host is resolved to address of internal or special network.
+	ErrAddressNotAllowed = utils.ErrAddressNotAllowed
+)
+
+var defaultSchemes = []string{"http", "https"}
+
+// checkURL checks url scheme and host by lists of config.
+func checkURL(u *url.URL, cfg Config) error {
+	schemes := cfg.AllowedSchemes
+	if len(schemes) == 0 {
+		schemes = defaultSchemes
+	}
+	if !contains(schemes, strings.ToLower(u.Scheme)) {
+		return fmt.Errorf("%w: %s", ErrSchemeNotAllowed, u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("%w: empty host", ErrHostNotAllowed)
+	}
+	if matchHost(host, cfg.DeniedHosts) || len(cfg.AllowedHosts) > 0 && !matchHost(host, cfg.AllowedHosts) {
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+	}
+	return nil
+}
+
+// matchHost checks host by list. Entry starting with dot matches host itself and all its subdomains.
+func matchHost(host string, list []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, entry := range list {
+		entry = strings.ToLower(entry)
+		if host == strings.TrimPrefix(entry, ".") {
+			return true
+		}
+		if strings.HasPrefix(entry, ".") && strings.HasSuffix(host, entry) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
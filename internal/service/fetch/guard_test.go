@@ -0,0 +1,89 @@
+package fetch_test
+
+import (
+	"context"
+	"interview-fm-backend/internal/service/fetch"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_FetchGuard(t *testing.T) {
+	target := "/image"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("image"))
+	}))
+	defer server.Close()
+	localhostURL := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	redirect := func(to string) string {
+		return server.URL + "/redirect?to=" + to
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		cfg  fetch.Config
+		url  string
+		err  error
+	}{
+		{"loopback is blocked", fetch.Config{}, server.URL + target, fetch.ErrAddressNotAllowed},
+		{"resolved address is checked", fetch.Config{AllowedHosts: []string{"localhost"}}, localhostURL + target, fetch.ErrAddressNotAllowed},
+		{"private network is blocked", fetch.Config{}, "http://10.0.0.1/image", fetch.ErrAddressNotAllowed},
+		{"metadata service is blocked", fetch.Config{}, "http://169.254.169.254/latest/meta-data/", fetch.ErrAddressNotAllowed},
+		{"ipv4-mapped loopback is blocked", fetch.Config{}, "http://[::ffff:127.0.0.1]:1/image", fetch.ErrAddressNotAllowed},
+		{"file scheme is blocked", fetch.Config{}, "file:///etc/passwd", fetch.ErrSchemeNotAllowed},
+		{"gopher scheme is blocked", fetch.Config{}, "gopher://example.com/", fetch.ErrSchemeNotAllowed},
+		{"denied host is blocked", fetch.Config{DeniedHosts: []string{".example.com"}}, "http://cdn.example.com/image", fetch.ErrHostNotAllowed},
+		{"denylist wins over allowlist", fetch.Config{AllowedHosts: []string{"example.com"}, DeniedHosts: []string{"example.com"}}, "http://example.com/image", fetch.ErrHostNotAllowed},
+		{"not allowed host is blocked", fetch.Config{AllowedHosts: []string{"example.com"}}, "http://example.org/image", fetch.ErrHostNotAllowed},
+		{"allowed network is fetched", fetch.Config{AllowedNetworks: localNetworks}, server.URL + target, nil},
+		{
+			"redirect to metadata service is blocked",
+			fetch.Config{AllowedNetworks: localNetworks},
+			redirect("http://169.254.169.254/latest/meta-data/"),
+			fetch.ErrAddressNotAllowed,
+		},
+		{
+			"redirect to denied host is blocked",
+			fetch.Config{AllowedNetworks: localNetworks, DeniedHosts: []string{"localhost"}},
+			redirect(localhostURL + target),
+			fetch.ErrHostNotAllowed,
+		},
+		{
+			"redirect to not allowed scheme is blocked",
+			fetch.Config{AllowedNetworks: localNetworks},
+			redirect("ftp://127.0.0.1/image"),
+			fetch.ErrSchemeNotAllowed,
+		},
+		{
+			"redirect to allowed host is followed",
+			fetch.Config{AllowedNetworks: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}},
+			redirect(localhostURL + target),
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.MaxSize = 10
+			tt.cfg.Retry = retryConfig
+			resp, err := fetch.NewService(tt.cfg).Fetch(ctx, tt.url, fetch.Validators{})
+			if tt.err == nil {
+				require.NoError(t, err)
+				require.Equal(t, []byte("image"), resp.Data)
+				return
+			}
+			require.ErrorIs(t, err, tt.err)
+			var fetchErr *fetch.Error
+			require.ErrorAs(t, err, &fetchErr)
+			require.Equal(t, fetch.ErrorClassForbidden, fetchErr.Class)
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"interview-fm-backend/internal/entities"
+	"interview-fm-backend/internal/utils"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ErrorClass groups fetch failures, retry policy is set for each class. Classes are defined in entities,
+// so they can be parsed by config without dependency on this package.
+type ErrorClass = entities.FetchErrorClass
+
+const (
+	ErrorClassNetwork   = entities.FetchErrorClassNetwork
+	ErrorClassTimeout   = entities.FetchErrorClassTimeout
+	ErrorClassThrottled = entities.FetchErrorClassThrottled
+	ErrorClassServer    = entities.FetchErrorClassServer
+	ErrorClassClient    = entities.FetchErrorClassClient
+	ErrorClassInvalid   = entities.FetchErrorClassInvalid
+	ErrorClassForbidden = entities.FetchErrorClassForbidden
+)
+
+// Error is failure of fetch after all attempts.
+type Error struct {
+	Class    ErrorClass
+	Attempts int
+	Err      error // error of last attempt
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%s error, attempts: %d)", e.Err, e.Class, e.Attempts)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+type RetryConfig struct {
+	MaxAttempts    int           // total attempts of download, including first one. 1 disables retries
+	InitialBackoff time.Duration // delay before second attempt, doubled for each next attempt
+	MaxBackoff     time.Duration
+	MaxRetryAfter  time.Duration // longer delay requested by `Retry-After` fails fetch without waiting
+	Classes        []ErrorClass  // classes of failures, which are retried
+}
+
+func (c RetryConfig) retryable(class ErrorClass) bool {
+	for _, retryClass := range c.Classes {
+		if retryClass == class {
+			return true
+		}
+	}
+	return false
+}
+
+// classify returns class of fetch failure.
+func classify(err error) ErrorClass {
+	if errors.Is(err, ErrSchemeNotAllowed) || errors.Is(err, ErrHostNotAllowed) || errors.Is(err, ErrAddressNotAllowed) {
+		return ErrorClassForbidden
+	}
+	var statusErr *utils.StatusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.StatusCode == http.StatusRequestTimeout:
+			return ErrorClassTimeout
+		case statusErr.StatusCode == http.StatusTooManyRequests, statusErr.StatusCode == http.StatusServiceUnavailable:
+			return ErrorClassThrottled
+		case statusErr.StatusCode >= 500:
+			return ErrorClassServer
+		}
+		return ErrorClassClient
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorClassTimeout
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return ErrorClassInvalid
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return ErrorClassNetwork
+	}
+	return ErrorClassInvalid
+}
+
+// delay returns wait time before next attempt, which is given by backoff.
+// Delay requested by server is respected, false is returned if it is longer than allowed.
+func (c RetryConfig) delay(backoff *utils.Backoff, err error) (time.Duration, bool) {
+	delay := backoff.Next()
+	var statusErr *utils.StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		if statusErr.RetryAfter > c.MaxRetryAfter {
+			return 0, false
+		}
+		if statusErr.RetryAfter > delay {
+			delay = statusErr.RetryAfter
+		}
+	}
+	return delay, true
+}
+
+// retry calls fn until it succeeds, fails with not retryable class or attempts are exhausted.
+// Retry is stopped early, if context is done or its deadline comes before next attempt.
+func (c RetryConfig) retry(ctx context.Context, fn func() error) (int, error) {
+	backoff := utils.NewBackoff(c.InitialBackoff, c.MaxBackoff)
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return attempt, nil
+		}
+		class := classify(err)
+		if attempt >= c.MaxAttempts || !c.retryable(class) {
+			return attempt, &Error{Class: class, Attempts: attempt, Err: err}
+		}
+		delay, ok := c.delay(backoff, err)
+		if deadline, hasDeadline := ctx.Deadline(); hasDeadline && time.Until(deadline) < delay {
+			ok = false
+		}
+		if !ok {
+			return attempt, &Error{Class: class, Attempts: attempt, Err: err}
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, &Error{Class: class, Attempts: attempt, Err: err}
+		}
+	}
+}
@@ -1,17 +1,91 @@
 package fetch
 
 import (
+	"container/list"
 	"context"
+	"fmt"
 	"interview-fm-backend/internal/utils"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sync"
+	"time"
 )
 
+type Config struct {
+	MaxSize int64 // max size of source image in bytes
+	// AllowedSchemes are url schemes images can be fetched by, empty list allows http and https.
+	AllowedSchemes []string
+	// AllowedHosts are hosts images can be fetched from, empty list allows any host.
+	// Entry starting with dot, like `.example.com`, allows all subdomains of host.
+	AllowedHosts []string
+	// DeniedHosts are hosts images can't be fetched from, even if they are allowed. Entries are matched as allowed ones.
+	DeniedHosts []string
+	// AllowedNetworks are exceptions from blocked loopback, private, link-local and other special networks,
+	// like internal image storage.
+	AllowedNetworks []netip.Prefix
+	Retry           RetryConfig
+	Client          ClientConfig
+}
+
+// Service downloads source images. Urls, including redirect targets, are checked by scheme and host lists,
+// resolved addresses are checked at dial time, so host can't be pointed to internal network by DNS after check.
+// Single client is shared by all fetches, so connections to the same host are pooled and reused.
 type Service struct {
+	mu     sync.RWMutex
+	cfg    Config
+	client *http.Client
+
+	hostsMU  sync.Mutex
+	hosts    map[string]*list.Element // element of hostsLRU by `host:port`
+	hostsLRU *list.List               // *hostCounters, recently used first
+}
+
+func NewService(cfg Config) *Service {
+	s := &Service{cfg: cfg, hosts: make(map[string]*list.Element), hostsLRU: list.New()}
+	s.client = s.newClient(cfg.Client)
+	return s
+}
+
+// SetConfig replaces configuration, fetches in progress are not affected.
+// Connection settings of client are kept, see ClientConfig.
+func (s *Service) SetConfig(cfg Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg = cfg
 }
 
-func NewService() *Service {
-	return &Service{}
+func (s *Service) config() Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cfg
 }
 
-func (s *Service) Fetch(ctx context.Context, url string) ([]byte, error) {
-	return utils.FetchURL(ctx, url)
+// Fetch downloads url. Transient failures are retried with exponential backoff by retry policy of config.
+// If validators are set, request is conditional and unchanged image is not downloaded.
+func (s *Service) Fetch(ctx context.Context, rawURL string, validators Validators) (Response, error) {
+	cfg := s.config()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Response{}, &Error{Class: ErrorClassInvalid, Err: fmt.Errorf("invalid url: %w", err)}
+	}
+	if err = checkURL(u, cfg); err != nil {
+		return Response{}, &Error{Class: ErrorClassForbidden, Err: err}
+	}
+	var result utils.FetchResult
+	attempts, err := cfg.Retry.retry(ctx, func() (err error) {
+		result, err = utils.FetchURL(ctx, s.client, rawURL, validators.header(), cfg.MaxSize)
+		return err
+	})
+	if err != nil {
+		return Response{}, err
+	}
+	return Response{
+		Data:        result.Data,
+		Attempts:    attempts,
+		NotModified: result.NotModified,
+		Validators:  validatorsOf(result.Header, validators),
+		ExpiresAt:   expiresAt(result.Header, time.Now()),
+		NoStore:     noStore(result.Header),
+	}, nil
 }
@@ -0,0 +1,196 @@
+package fetch_test
+
+import (
+	"context"
+	"errors"
+	"interview-fm-backend/internal/service/fetch"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// localNetworks allow requests to test servers.
+var localNetworks = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}
+
+var retryConfig = fetch.RetryConfig{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     2 * time.Millisecond,
+	MaxRetryAfter:  time.Second,
+	Classes:        []fetch.ErrorClass{fetch.ErrorClassNetwork, fetch.ErrorClassThrottled, fetch.ErrorClassServer},
+}
+
+func TestService_Fetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("image"))
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	t.Run("should fetch from any host by default", func(t *testing.T) {
+		resp, err := fetch.NewService(fetch.Config{AllowedNetworks: localNetworks, MaxSize: 10}).Fetch(ctx, server.URL, fetch.Validators{})
+		require.NoError(t, err)
+		require.Equal(t, fetch.Response{Data: []byte("image"), Attempts: 1}, resp)
+	})
+	t.Run("should reject too big image", func(t *testing.T) {
+		_, err := fetch.NewService(fetch.Config{AllowedNetworks: localNetworks, MaxSize: 4, Retry: retryConfig}).Fetch(ctx, server.URL, fetch.Validators{})
+		require.ErrorContains(t, err, "image is bigger than 4 bytes")
+		requireFetchError(t, err, fetch.ErrorClassInvalid, 1)
+	})
+	t.Run("should check allowlist", func(t *testing.T) {
+		service := fetch.NewService(fetch.Config{AllowedNetworks: localNetworks, MaxSize: 10, AllowedHosts: []string{".example.com"}})
+		_, err := service.Fetch(ctx, server.URL, fetch.Validators{})
+		require.ErrorIs(t, err, fetch.ErrHostNotAllowed)
+		_, err = service.Fetch(ctx, "http://cdn.example.com.evil.org/image.jpg", fetch.Validators{})
+		require.ErrorIs(t, err, fetch.ErrHostNotAllowed)
+
+		service.SetConfig(fetch.Config{AllowedNetworks: localNetworks, MaxSize: 10, AllowedHosts: []string{"example.com", "127.0.0.1"}})
+		resp, err := service.Fetch(ctx, server.URL, fetch.Validators{})
+		require.NoError(t, err)
+		require.Equal(t, []byte("image"), resp.Data)
+	})
+}
+
+// statusServer responds with statuses in order, last status is repeated.
+func statusServer(t *testing.T, retryAfter string, statuses ...int) (*httptest.Server, *uint64) {
+	requests := uint64(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := atomic.AddUint64(&requests, 1)
+		status := statuses[len(statuses)-1]
+		if int(n) <= len(statuses) {
+			status = statuses[n-1]
+		}
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("image"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func requireFetchError(t *testing.T, err error, class fetch.ErrorClass, attempts int) {
+	t.Helper()
+	var fetchErr *fetch.Error
+	require.True(t, errors.As(err, &fetchErr), err)
+	require.Equal(t, class, fetchErr.Class)
+	require.Equal(t, attempts, fetchErr.Attempts)
+}
+
+func TestService_FetchRetry(t *testing.T) {
+	ctx := context.Background()
+	service := fetch.NewService(fetch.Config{AllowedNetworks: localNetworks, MaxSize: 10, Retry: retryConfig})
+
+	t.Run("should retry transient failures", func(t *testing.T) {
+		server, requests := statusServer(t, "", http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK)
+		resp, err := service.Fetch(ctx, server.URL, fetch.Validators{})
+		require.NoError(t, err)
+		require.Equal(t, fetch.Response{Data: []byte("image"), Attempts: 3}, resp)
+		require.Equal(t, uint64(3), atomic.LoadUint64(requests))
+	})
+	t.Run("should stop after max attempts", func(t *testing.T) {
+		server, requests := statusServer(t, "", http.StatusInternalServerError)
+		_, err := service.Fetch(ctx, server.URL, fetch.Validators{})
+		requireFetchError(t, err, fetch.ErrorClassServer, 3)
+		require.Equal(t, uint64(3), atomic.LoadUint64(requests))
+	})
+	t.Run("should not retry client errors", func(t *testing.T) {
+		server, requests := statusServer(t, "", http.StatusNotFound)
+		_, err := service.Fetch(ctx, server.URL, fetch.Validators{})
+		requireFetchError(t, err, fetch.ErrorClassClient, 1)
+		require.Equal(t, uint64(1), atomic.LoadUint64(requests))
+	})
+	t.Run("should not retry classes disabled by config", func(t *testing.T) {
+		server, _ := statusServer(t, "", http.StatusRequestTimeout)
+		_, err := service.Fetch(ctx, server.URL, fetch.Validators{})
+		requireFetchError(t, err, fetch.ErrorClassTimeout, 1)
+	})
+	t.Run("should wait for retry after", func(t *testing.T) {
+		server, _ := statusServer(t, "1", http.StatusTooManyRequests, http.StatusOK)
+		start := time.Now()
+		resp, err := service.Fetch(ctx, server.URL, fetch.Validators{})
+		require.NoError(t, err)
+		require.Equal(t, 2, resp.Attempts)
+		require.GreaterOrEqual(t, time.Since(start), time.Second)
+	})
+	t.Run("should fail if retry after is too long", func(t *testing.T) {
+		server, requests := statusServer(t, "60", http.StatusTooManyRequests, http.StatusOK)
+		_, err := service.Fetch(ctx, server.URL, fetch.Validators{})
+		requireFetchError(t, err, fetch.ErrorClassThrottled, 1)
+		require.Equal(t, uint64(1), atomic.LoadUint64(requests))
+	})
+	t.Run("should fail if retry doesn't fit into deadline", func(t *testing.T) {
+		server, _ := statusServer(t, "1", http.StatusServiceUnavailable, http.StatusOK)
+		deadlineCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		_, err := service.Fetch(deadlineCtx, server.URL, fetch.Validators{})
+		requireFetchError(t, err, fetch.ErrorClassThrottled, 1)
+	})
+	t.Run("should retry network errors", func(t *testing.T) {
+		server, _ := statusServer(t, "", http.StatusOK)
+		server.Close()
+		_, err := service.Fetch(ctx, server.URL, fetch.Validators{})
+		requireFetchError(t, err, fetch.ErrorClassNetwork, 3)
+	})
+}
+
+func TestService_FetchConditional(t *testing.T) {
+	const etag = `"v1"`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		_, _ = w.Write([]byte("image"))
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	service := fetch.NewService(fetch.Config{AllowedNetworks: localNetworks, MaxSize: 10})
+
+	start := time.Now()
+	resp, err := service.Fetch(ctx, server.URL, fetch.Validators{})
+	require.NoError(t, err)
+	require.Equal(t, []byte("image"), resp.Data)
+	require.False(t, resp.NotModified)
+	require.Equal(t, fetch.Validators{ETag: etag, LastModified: "Mon, 02 Jan 2006 15:04:05 GMT"}, resp.Validators)
+	require.WithinDuration(t, start.Add(time.Minute), resp.ExpiresAt, time.Second)
+	require.False(t, resp.NoStore)
+
+	t.Run("should report not modified image", func(t *testing.T) {
+		notModified, err := service.Fetch(ctx, server.URL, resp.Validators)
+		require.NoError(t, err)
+		require.True(t, notModified.NotModified)
+		require.Empty(t, notModified.Data)
+		require.Equal(t, resp.Validators, notModified.Validators)
+		require.False(t, notModified.ExpiresAt.IsZero())
+	})
+	t.Run("should download changed image", func(t *testing.T) {
+		changed, err := service.Fetch(ctx, server.URL, fetch.Validators{ETag: `"v0"`})
+		require.NoError(t, err)
+		require.False(t, changed.NotModified)
+		require.Equal(t, []byte("image"), changed.Data)
+	})
+	t.Run("should report not stored image", func(t *testing.T) {
+		private, err := service.Fetch(ctx, server.URL+"/private", fetch.Validators{})
+		require.NoError(t, err)
+		require.True(t, private.NoStore)
+		require.False(t, private.ExpiresAt.After(time.Now()))
+	})
+	t.Run("should reject unexpected not modified status", func(t *testing.T) {
+		server, _ := statusServer(t, "", http.StatusNotModified)
+		_, err := service.Fetch(ctx, server.URL, fetch.Validators{})
+		requireFetchError(t, err, fetch.ErrorClassClient, 1)
+	})
+}
@@ -0,0 +1,60 @@
+package fetch
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// header returns request header of conditional request, nil if validators are empty.
+func (v Validators) header() http.Header {
+	if v.ETag == "" && v.LastModified == "" {
+		return nil
+	}
+	header := http.Header{}
+	if v.ETag != "" {
+		header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		header.Set("If-Modified-Since", v.LastModified)
+	}
+	return header
+}
+
+// validatorsOf returns validators of response. 304 response can omit them, then validators of request are kept.
+func validatorsOf(header http.Header, sent Validators) Validators {
+	v := Validators{ETag: header.Get("ETag"), LastModified: header.Get("Last-Modified")}
+	if v.ETag == "" && v.LastModified == "" {
+		return sent
+	}
+	return v
+}
+
+// expiresAt returns when response should be revalidated by its `Cache-Control` header.
+func expiresAt(header http.Header, now time.Time) time.Time {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			return now
+		case "max-age":
+			seconds, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+			if err != nil || seconds < 0 {
+				return now
+			}
+			return now.Add(time.Duration(seconds) * time.Second)
+		}
+	}
+	return time.Time{}
+}
+
+// noStore checks if `Cache-Control` header forbids to store response.
+func noStore(header http.Header) bool {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+			return true
+		}
+	}
+	return false
+}
@@ -6,7 +6,9 @@ import (
 )
 
 type Orchestrator interface {
-	ProcessResizes(ctx context.Context, request *entities.ResizeRequest, async bool) ([]entities.ResizeResult, error)
+	ProcessResizes(ctx context.Context, request *entities.ResizeRequest, async bool) (entities.ResizeResponse, error)
 	GetImage(ctx context.Context, imageID string) ([]byte, bool, error)
+	GetJob(ctx context.Context, jobID string) (*entities.JobStatus, bool, error)
+	WatchJob(ctx context.Context, jobID string) (<-chan entities.JobImageStatus, bool, error)
 	Shutdown() error
 }
@@ -1,112 +1,167 @@
 package orchestrator
 
 import (
-	"container/list"
 	"context"
-	"fmt"
 	"interview-fm-backend/internal/entities"
 	"interview-fm-backend/internal/logger"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
 )
 
 type task struct {
-	url     string
-	imageID string
-	width   uint
-	height  uint
+	url      string
+	imageID  string
+	params   entities.ResizeParams
+	priority entities.Priority
+	clientID string
+	// revalidate checks source of cached image, even if it is not expired
+	revalidate bool
 }
 
-// handleNewJob save value `imageURLHash` at map with status "processing" and add new task to queue.
-// If same hash already in map - than it mean that image already in queue, so we just return.
+// handleNewJobs save value `imageID` at map with status "processing" and add new tasks to queue.
+// If same imageID already in map - than it mean that image already in queue, so task is skipped.
+// If queue has no capacity for all new tasks, none of them is added and ErrQueueFull is returned.
 // If processing return error - we update map with status "failed".
 // If processing return success - we update map with status "success".
-func (s *Service) handleNewJob(log logger.AppLogger, url, imageID string, width, height uint) {
-	log.Info("handling new job")
+// Status containers of tasks are returned in order of tasks, so job keeps status of images it requested,
+// even if they are processed again by later requests.
+func (s *Service) handleNewJobs(log logger.AppLogger, tasks []*task) ([]*imageStatusContainer, error) {
 	s.imageStatusMU.Lock()
 	defer s.imageStatusMU.Unlock()
-	if _, ok := s.imageStatus[imageID]; ok {
-		log.Info("image already in progress")
-		return
+	newTasks := s.registerTasks(log, tasks)
+	if err := s.queue.Push(newTasks...); err != nil {
+		for _, t := range newTasks {
+			delete(s.imageStatus, t.imageID)
+		}
+		atomic.AddUint64(&s.rejected, 1)
+		log.Info("queue is full", zap.Int("tasks", len(newTasks)))
+		return nil, err
+	}
+	log.Info("new jobs added to queue", zap.Int("tasks", len(newTasks)))
+	containers := make([]*imageStatusContainer, 0, len(tasks))
+	for _, t := range tasks {
+		containers = append(containers, s.imageStatus[t.imageID])
+	}
+	return containers, nil
+}
+
+// registerTasks adds status containers for tasks and returns tasks, which are not known yet.
+// Failed images are registered again, so they are retried by new request.
+// Processed images are registered again, if their source should be revalidated. imageStatusMU should be locked by caller.
+// Finished images, which are not requested for jobTTL, are removed, as their jobs are expired too.
+// Queued image, requested again with higher priority, is moved to lane of that priority.
+func (s *Service) registerTasks(log logger.AppLogger, tasks []*task) []*task {
+	newTasks := make([]*task, 0, len(tasks))
+	now := time.Now()
+	s.pruneImageStatus(now)
+	for _, t := range tasks {
+		if container, ok := s.imageStatus[t.imageID]; ok && !container.reprocess(t.revalidate, now) {
+			log.Info("image already in progress", zap.String("imageID", t.imageID))
+			container.requestedAt = now
+			if container.status == entities.ResizeResultStatusProcessing && higherPriority(t.priority, container.priority) {
+				container.priority = t.priority
+				if s.queue.Promote(t.imageID, t.priority) {
+					log.Info("queued image promoted", zap.String("imageID", t.imageID), zap.String("priority", string(t.priority)))
+				}
+			}
+			continue
+		}
+		s.imageStatus[t.imageID] = &imageStatusContainer{
+			status:      entities.ResizeResultStatusProcessing,
+			signal:      make(chan struct{}),
+			priority:    t.priority,
+			queuedAt:    now,
+			requestedAt: now,
+		}
+		newTasks = append(newTasks, t)
 	}
-	s.imageStatus[imageID] = &imageStatusContainer{
-		status: entities.ResizeResultStatusProcessing,
-		signal: make(chan struct{}),
+	return newTasks
+}
+
+// pruneImageStatus removes finished images, which are not requested for jobTTL. imageStatusMU should be locked by caller.
+func (s *Service) pruneImageStatus(now time.Time) {
+	for imageID, container := range s.imageStatus {
+		if container.status == entities.ResizeResultStatusProcessing {
+			continue
+		}
+		if now.Sub(container.requestedAt) > jobTTL && now.Sub(container.finishedAt) > jobTTL {
+			delete(s.imageStatus, imageID)
+		}
 	}
+}
 
-	s.queueMU.Lock()
-	defer s.queueMU.Unlock()
-	s.queue.PushBack(&task{
-		url:     url,
-		imageID: imageID,
-		height:  height,
-		width:   width,
-	})
-	log.Info("new job added to queue")
+// reprocess checks if image should be processed again by new task.
+func (c *imageStatusContainer) reprocess(revalidate bool, now time.Time) bool {
+	switch c.status {
+	case entities.ResizeResultStatusFailure:
+		return true
+	case entities.ResizeResultStatusSuccess:
+		return revalidate || !c.expiresAt.IsZero() && !now.Before(c.expiresAt)
+	case entities.ResizeResultStatusProcessing:
+	}
+	return false
 }
 
-// worker start infinite loop to process queue. It will stop when context is done and close workerDone channel at the end.
-// When from maxAsyncImagesRequests was read empty struct - than task processing starting from queue.
-// When task is done, it will push struct back to maxAsyncImagesRequests.
-// So maxAsyncImagesRequests regulate, how much parallel execution allowed for async processing.
+// worker start loop to process queue. It will stop when service is stopped and close workerDone channel at the end.
+// When slot from asyncSlots is acquired - than worker waits for task in queue and starts processing.
+// When task is done, slot is released.
+// So asyncSlots regulate, how much parallel execution allowed for async processing.
 // When loop is done, it will wait all tasks to be done, using sync.WaitGroup to control it.
 func (s *Service) worker() {
 	var wg sync.WaitGroup
-	var c sync.Cond
-	c.Broadcast()
-loop:
 	for {
-		select {
-		case <-s.maxAsyncImagesRequests:
-			wg.Add(1)
-			s.queueMU.Lock()
-			e := s.queue.Front()
-			if e != nil {
-				s.queue.Remove(e)
-			}
-			s.queueMU.Unlock()
-			if e == nil {
-				s.maxAsyncImagesRequests <- struct{}{}
-				wg.Done()
-				// no more tasks in queue, wait for new tasks
-				time.Sleep(50 * time.Millisecond)
-				continue
-			}
-			go func(el *list.Element) {
-				s.processQueue(el)
-				s.maxAsyncImagesRequests <- struct{}{}
-				wg.Done()
-			}(e)
-		case <-s.ctx.Done():
-			break loop
+		if err := s.asyncSlots.Acquire(s.ctx, ""); err != nil {
+			break
+		}
+		t, ok := s.queue.Pop()
+		if !ok {
+			// service is stopping, remaining tasks should stay in queue
+			s.asyncSlots.Release("")
+			break
 		}
+		wg.Add(1)
+		go func(t *task) {
+			defer wg.Done()
+			s.processQueue(t)
+			s.queue.Done(t)
+			s.asyncSlots.Release("")
+		}(t)
 	}
 	wg.Wait()
 	close(s.workerDone)
 }
 
-func (s *Service) processQueue(el *list.Element) {
-	t, ok := el.Value.(*task)
-	if !ok {
-		s.log.Error("invalid task type", fmt.Errorf("expected type is pointer to task"), zap.Any("task", el))
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+func (s *Service) processQueue(t *task) {
+	ctx, cancel := context.WithTimeout(s.ctx, s.config().TaskTimeout)
 	defer cancel()
 
 	log := s.log.With(zap.String("source", "background")).
-		With(zap.Uint("width", t.width)).
-		With(zap.Uint("height", t.height)).
+		With(zap.Any("params", t.params)).
 		With(zap.String("url", t.url))
 
 	log.Info("processing background resizes")
-	res := s.processURL(ctx, log, t.url, t.width, t.height)
+	s.imageStatusMU.Lock()
+	s.imageStatus[t.imageID].startedAt = time.Now()
+	s.imageStatusMU.Unlock()
+	res, expiresAt := s.processURL(ctx, log, t.url, t.params, t.revalidate)
+	if res.Result == entities.ResizeResultStatusFailure && s.ctx.Err() != nil {
+		// processing was interrupted by shutdown, return task to queue, so it will be stored in journal
+		log.Info("background resizes interrupted")
+		s.queue.Requeue(t)
+		return
+	}
 	log.Info("background resizes done")
 	s.imageStatusMU.Lock()
 	defer s.imageStatusMU.Unlock()
-	close(s.imageStatus[t.imageID].signal)
-	s.imageStatus[t.imageID].status = res.Result
+	container := s.imageStatus[t.imageID]
+	close(container.signal)
+	container.status = res.Result
+	container.err = res.Error
+	container.attempts = res.Attempts
+	container.expiresAt = expiresAt
+	container.finishedAt = time.Now()
+	container.url = res.URL
 }
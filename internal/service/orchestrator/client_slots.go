@@ -0,0 +1,139 @@
+package orchestrator
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+type slotClient struct {
+	inUse   int
+	waiters *list.List    // channels of waiting Acquire calls, closed when slot is given
+	ring    *list.Element // element in clientSlots.waiting, nil if client has no waiters
+}
+
+// clientSlots limits parallel processing in total and for each client.
+// Freed slot is given to waiting clients in round-robin order,
+// so client with many waiting images can't take all slots from others.
+type clientSlots struct {
+	mu        sync.Mutex
+	capacity  int
+	perClient int
+	inUse     int
+	clients   map[string]*slotClient
+	waiting   *list.List // clients with waiters in round-robin order
+}
+
+func newClientSlots(capacity, perClient int) *clientSlots {
+	return &clientSlots{
+		capacity:  capacity,
+		perClient: perClient,
+		clients:   map[string]*slotClient{},
+		waiting:   list.New(),
+	}
+}
+
+// SetLimits changes total and per client limits. Slots in use are not taken back, when limits are decreased,
+// new slots are given only after usage falls below new limits.
+func (c *clientSlots) SetLimits(capacity, perClient int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.capacity = capacity
+	c.perClient = perClient
+	c.dispatch()
+}
+
+// Acquire waits for free slot. Slot should be returned by Release, if no error is returned.
+func (c *clientSlots) Acquire(ctx context.Context, clientID string) error {
+	c.mu.Lock()
+	client, ok := c.clients[clientID]
+	if !ok {
+		client = &slotClient{waiters: list.New()}
+		c.clients[clientID] = client
+	}
+	if client.waiters.Len() == 0 && c.inUse < c.capacity && client.inUse < c.perClient {
+		client.inUse++
+		c.inUse++
+		c.mu.Unlock()
+		return nil
+	}
+	granted := make(chan struct{})
+	waiter := client.waiters.PushBack(granted)
+	if client.ring == nil {
+		client.ring = c.waiting.PushBack(client)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-granted:
+		return nil
+	case <-ctx.Done():
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-granted:
+		// slot was given while waiting for lock, return it to others
+		c.release(clientID, client)
+		return ctx.Err()
+	default:
+	}
+	client.waiters.Remove(waiter)
+	if client.waiters.Len() == 0 {
+		c.waiting.Remove(client.ring)
+		client.ring = nil
+	}
+	c.cleanup(clientID, client)
+	return ctx.Err()
+}
+
+// Release returns slot taken by Acquire.
+func (c *clientSlots) Release(clientID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if client, ok := c.clients[clientID]; ok {
+		c.release(clientID, client)
+	}
+}
+
+func (c *clientSlots) release(clientID string, client *slotClient) {
+	client.inUse--
+	c.inUse--
+	c.dispatch()
+	c.cleanup(clientID, client)
+}
+
+// dispatch gives free slots to waiting clients, which have not reached their limit.
+// Client, which got slot, is moved to the end of round-robin order.
+func (c *clientSlots) dispatch() {
+	for c.inUse < c.capacity {
+		var next *list.Element
+		for e := c.waiting.Front(); e != nil; e = e.Next() {
+			if client, ok := e.Value.(*slotClient); ok && client.inUse < c.perClient {
+				next = e
+				break
+			}
+		}
+		if next == nil {
+			return
+		}
+		client, _ := next.Value.(*slotClient)
+		granted, _ := client.waiters.Remove(client.waiters.Front()).(chan struct{})
+		client.inUse++
+		c.inUse++
+		close(granted)
+		c.waiting.Remove(next)
+		client.ring = nil
+		if client.waiters.Len() > 0 {
+			client.ring = c.waiting.PushBack(client)
+		}
+	}
+}
+
+// cleanup forgets idle client, so map does not grow with every client ever seen.
+func (c *clientSlots) cleanup(clientID string, client *slotClient) {
+	if client.inUse == 0 && client.waiters.Len() == 0 {
+		delete(c.clients, clientID)
+	}
+}
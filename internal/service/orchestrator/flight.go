@@ -0,0 +1,92 @@
+package orchestrator
+
+import (
+	"context"
+	"interview-fm-backend/internal/entities"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// flight is processing of single image, which can be shared by several requests.
+type flight struct {
+	done      chan struct{}
+	result    entities.ResizeResult
+	expiresAt time.Time
+	canceled  bool // processing failed because context of its owner was done
+}
+
+// flightGroup coalesces identical processing of images, so one fetch and resize serves all requests, which come
+// while it is in progress. Both sync requests and async tasks use it.
+type flightGroup struct {
+	mu        sync.Mutex
+	flights   map[string]*flight
+	coalesced uint64 // requests served by processing started by other request
+	waiting   int64  // requests waiting for processing started by other request
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{flights: map[string]*flight{}}
+}
+
+// do calls fn, if there is no processing of key in progress, otherwise waits for its result.
+// If processing fails because its owner went away, waiter starts it again, so it isn't failed by other request.
+func (g *flightGroup) do(
+	ctx context.Context,
+	key string,
+	fn func(ctx context.Context) (entities.ResizeResult, time.Time),
+) (entities.ResizeResult, time.Time, bool) {
+	for {
+		g.mu.Lock()
+		f, ok := g.flights[key]
+		if !ok {
+			f = &flight{done: make(chan struct{})}
+			g.flights[key] = f
+			g.mu.Unlock()
+			g.run(ctx, key, f, fn)
+			return f.result, f.expiresAt, false
+		}
+		g.mu.Unlock()
+
+		atomic.AddInt64(&g.waiting, 1)
+		select {
+		case <-f.done:
+			atomic.AddInt64(&g.waiting, -1)
+		case <-ctx.Done():
+			atomic.AddInt64(&g.waiting, -1)
+			return entities.ResizeResult{Result: entities.ResizeResultStatusFailure, Error: publicError(ctx.Err())}, time.Time{}, true
+		}
+		if !f.canceled {
+			atomic.AddUint64(&g.coalesced, 1)
+			return f.result, f.expiresAt, true
+		}
+	}
+}
+
+// run calls fn for flight and releases its waiters. If fn panics, waiters get failure and panic is passed to caller.
+func (g *flightGroup) run(
+	ctx context.Context,
+	key string,
+	f *flight,
+	fn func(ctx context.Context) (entities.ResizeResult, time.Time),
+) {
+	f.result = entities.ResizeResult{Result: entities.ResizeResultStatusFailure, Error: "processing failed"}
+	defer func() {
+		g.mu.Lock()
+		delete(g.flights, key)
+		g.mu.Unlock()
+		close(f.done)
+	}()
+	f.result, f.expiresAt = fn(ctx)
+	f.canceled = f.result.Result == entities.ResizeResultStatusFailure && ctx.Err() != nil
+}
+
+// Waiting returns count of requests waiting for processing of other requests.
+func (g *flightGroup) Waiting() int {
+	return int(atomic.LoadInt64(&g.waiting))
+}
+
+// Coalesced returns count of requests served by processing of other requests.
+func (g *flightGroup) Coalesced() uint64 {
+	return atomic.LoadUint64(&g.coalesced)
+}
@@ -0,0 +1,89 @@
+package orchestrator
+
+import (
+	"context"
+	"interview-fm-backend/internal/entities"
+)
+
+// WatchJob streams status changes of async job images.
+// Current status of every image is sent first, than image status is sent again when its processing is done.
+// Channel is closed when all images are done, ctx is done or service is stopped.
+func (s *Service) WatchJob(ctx context.Context, jobID string) (<-chan entities.JobImageStatus, bool, error) {
+	s.jobsMU.RLock()
+	j, ok := s.jobs[jobID]
+	s.jobsMU.RUnlock()
+	if !ok {
+		return nil, false, nil
+	}
+	events := make(chan entities.JobImageStatus)
+	go s.watchJob(ctx, j, events)
+	return events, true, nil
+}
+
+// watchJob waits for signals of processing images, so no polling of queue is needed.
+func (s *Service) watchJob(ctx context.Context, j *job, events chan<- entities.JobImageStatus) {
+	defer close(events)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	send := func(event entities.JobImageStatus) bool {
+		select {
+		case events <- event:
+			return true
+		case <-ctx.Done():
+			return false
+		case <-s.ctx.Done():
+			return false
+		}
+	}
+
+	positions := s.queuePositions()
+	s.imageStatusMU.RLock()
+	initial := make([]entities.JobImageStatus, 0, len(j.images))
+	signals := make([]chan struct{}, 0, len(j.images))
+	for _, image := range j.images {
+		initial = append(initial, s.jobImageStatus(image, positions))
+		var signal chan struct{}
+		if image.status != nil {
+			signal = image.status.signal
+		}
+		signals = append(signals, signal)
+	}
+	s.imageStatusMU.RUnlock()
+
+	done := make(chan int, len(j.images)) // indexes of finished images
+	pending := 0
+	for i, event := range initial {
+		if !send(event) {
+			return
+		}
+		if event.Result != entities.ResizeResultStatusProcessing {
+			continue
+		}
+		pending++
+		go func(i int, signal chan struct{}) {
+			select {
+			case <-signal:
+				done <- i
+			case <-ctx.Done():
+			case <-s.ctx.Done():
+			}
+		}(i, signals[i])
+	}
+
+	for ; pending > 0; pending-- {
+		select {
+		case i := <-done:
+			s.imageStatusMU.RLock()
+			event := s.jobImageStatus(j.images[i], nil)
+			s.imageStatusMU.RUnlock()
+			if !send(event) {
+				return
+			}
+		case <-ctx.Done():
+			return
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package orchestrator
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"interview-fm-backend/internal/entities"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// jobTTL is how long finished jobs are kept for status requests.
+const jobTTL = time.Hour
+
+// callbackTimeout limits delivery of job callback, including retries.
+// Delivery is not canceled by shutdown, so it can delay shutdown up to this time.
+const callbackTimeout = 2 * time.Minute
+
+type jobImage struct {
+	sourceURL string
+	imageID   string
+	url       string
+	// status is processing of image requested by job. Reprocessing of image creates new container,
+	// so status of finished image is not changed by later requests.
+	status *imageStatusContainer
+	// finished is status of image finished before restart, used when image is not tracked anymore
+	finished *entities.JobImageStatus
+}
+
+// job is set of images requested by single async request.
+type job struct {
+	id          string
+	callbackURL string
+	createdAt   time.Time
+	images      []jobImage
+}
+
+func newJobID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate job id: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// addJob registers new job and removes expired finished jobs.
+// If job has callback url, delivery of results is started in background.
+func (s *Service) addJob(jobID, callbackURL string, images []jobImage) {
+	now := time.Now()
+	s.jobsMU.Lock()
+	defer s.jobsMU.Unlock()
+	for id, j := range s.jobs {
+		if now.Sub(j.createdAt) > jobTTL && s.jobStatus(j, nil).Status != entities.ResizeResultStatusProcessing {
+			delete(s.jobs, id)
+		}
+	}
+	s.putJob(&job{id: jobID, callbackURL: callbackURL, createdAt: now, images: images})
+}
+
+// putJob registers job. If job has callback url, delivery of results is started in background.
+// jobsMU should be locked by caller.
+func (s *Service) putJob(j *job) {
+	s.jobs[j.id] = j
+	if j.callbackURL != "" && s.notifier != nil {
+		s.callbacks.Add(1)
+		go s.notifyJob(j)
+	}
+}
+
+// notifyJob waits until all images of job are done and sends results to callback url.
+// If service is stopped before, job is stored in journal and callback is armed again after restart.
+// Without journal current results are sent, so receiver knows that job is interrupted.
+func (s *Service) notifyJob(j *job) {
+	defer s.callbacks.Done()
+	s.imageStatusMU.RLock()
+	signals := make([]chan struct{}, 0, len(j.images))
+	for _, image := range j.images {
+		if image.status != nil {
+			signals = append(signals, image.status.signal)
+		}
+	}
+	s.imageStatusMU.RUnlock()
+
+	for _, signal := range signals {
+		select {
+		case <-signal:
+		case <-s.ctx.Done():
+		}
+	}
+
+	status := s.jobStatus(j, nil)
+	if status.Status == entities.ResizeResultStatusProcessing && s.config().JournalPath != "" {
+		s.log.Info("job callback is postponed until restart", zap.String("jobID", j.id))
+		return
+	}
+	results := make([]entities.ResizeResult, 0, len(status.Images))
+	for _, image := range status.Images {
+		results = append(results, entities.ResizeResult{
+			Result:   image.Result,
+			URL:      image.URL,
+			Error:    image.Error,
+			Attempts: image.Attempts,
+		})
+	}
+	// delivery is detached from shutdown, so finished jobs are not lost to dead-letter log
+	ctx, cancel := context.WithTimeout(context.Background(), callbackTimeout)
+	defer cancel()
+	if err := s.notifier.Notify(ctx, j.callbackURL, j.id, results); err != nil {
+		s.log.Error("failed to notify job callback", err, zap.String("jobID", j.id))
+	}
+}
+
+// GetJob returns current status of async job. It never waits for processing.
+func (s *Service) GetJob(_ context.Context, jobID string) (*entities.JobStatus, bool, error) {
+	s.jobsMU.RLock()
+	j, ok := s.jobs[jobID]
+	s.jobsMU.RUnlock()
+	if !ok {
+		return nil, false, nil
+	}
+	status := s.jobStatus(j, s.queuePositions())
+	return &status, true, nil
+}
+
+// jobStatus collects status of job images. Positions are positions of images in queue, can be nil if not needed.
+func (s *Service) jobStatus(j *job, positions map[string]int) entities.JobStatus {
+	status := entities.JobStatus{
+		ID:        j.id,
+		Status:    entities.ResizeResultStatusSuccess,
+		CreatedAt: j.createdAt,
+		Images:    make([]entities.JobImageStatus, 0, len(j.images)),
+	}
+
+	s.imageStatusMU.RLock()
+	defer s.imageStatusMU.RUnlock()
+	for _, image := range j.images {
+		imageStatus := s.jobImageStatus(image, positions)
+		switch {
+		case imageStatus.Result == entities.ResizeResultStatusProcessing:
+			status.Status = entities.ResizeResultStatusProcessing
+		case imageStatus.Result == entities.ResizeResultStatusFailure && status.Status == entities.ResizeResultStatusSuccess:
+			status.Status = entities.ResizeResultStatusFailure
+		}
+		status.Images = append(status.Images, imageStatus)
+	}
+	return status
+}
+
+// jobImageStatus returns status of single job image. imageStatusMU should be locked by caller.
+func (s *Service) jobImageStatus(image jobImage, positions map[string]int) entities.JobImageStatus {
+	imageStatus := entities.JobImageStatus{
+		SourceURL: image.sourceURL,
+		URL:       image.url,
+		Result:    entities.ResizeResultStatusFailure,
+	}
+	if image.finished != nil {
+		imageStatus = *image.finished
+	}
+	if container := image.status; container != nil {
+		imageStatus.Result = container.status
+		imageStatus.Error = container.err
+		imageStatus.Attempts = container.attempts
+		imageStatus.QueuePosition = positions[image.imageID]
+		imageStatus.QueuedAt = timePtr(container.queuedAt)
+		imageStatus.StartedAt = timePtr(container.startedAt)
+		imageStatus.FinishedAt = timePtr(container.finishedAt)
+		if container.url != "" {
+			imageStatus.URL = container.url
+		}
+	}
+	if imageStatus.Result != entities.ResizeResultStatusSuccess {
+		imageStatus.URL = ""
+	}
+	return imageStatus
+}
+
+// queuePositions returns 1 based positions of images waiting in queue.
+func (s *Service) queuePositions() map[string]int {
+	tasks := s.queue.Tasks()
+	positions := make(map[string]int, len(tasks))
+	for i, t := range tasks {
+		positions[t.imageID] = i + 1
+	}
+	return positions
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
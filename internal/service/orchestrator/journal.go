@@ -0,0 +1,160 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"interview-fm-backend/internal/entities"
+	"interview-fm-backend/internal/utils"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// journalTask is persisted form of task, which was not processed before shutdown.
+type journalTask struct {
+	URL      string                `json:"url"`
+	ImageID  string                `json:"image_id"`
+	Params   entities.ResizeParams `json:"params"`
+	Priority entities.Priority     `json:"priority,omitempty"`
+	ClientID string                `json:"client_id,omitempty"`
+
+	Revalidate bool `json:"revalidate,omitempty"`
+}
+
+// journalJob is persisted form of job, which was not finished before shutdown.
+// Statuses of finished images are kept, as they are not tracked after restart.
+type journalJob struct {
+	ID          string            `json:"id"`
+	CallbackURL string            `json:"callback_url,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	Images      []journalJobImage `json:"images"`
+}
+
+type journalJobImage struct {
+	SourceURL string                   `json:"source_url"`
+	ImageID   string                   `json:"image_id"`
+	URL       string                   `json:"url"`
+	Status    *entities.JobImageStatus `json:"status,omitempty"` // empty if image is not finished
+}
+
+// journal is content of journal file.
+type journal struct {
+	Tasks []journalTask `json:"tasks"`
+	Jobs  []journalJob  `json:"jobs,omitempty"`
+}
+
+// dumpQueue stores pending tasks and unfinished jobs to journal file, so they can be resumed after restart.
+// Should be called only after background worker and job callbacks are stopped.
+func (s *Service) dumpQueue() error {
+	journalPath := s.config().JournalPath
+	if journalPath == "" {
+		return nil
+	}
+	queued := s.queue.Tasks()
+	tasks := make([]journalTask, 0, len(queued))
+	for _, t := range queued {
+		tasks = append(tasks, journalTask{
+			URL:        t.url,
+			ImageID:    t.imageID,
+			Params:     t.params,
+			Priority:   t.priority,
+			ClientID:   t.clientID,
+			Revalidate: t.revalidate,
+		})
+	}
+
+	jobs := s.unfinishedJobs()
+
+	s.log.Info("dumping queue...", zap.Int("tasks", len(tasks)), zap.Int("jobs", len(jobs)))
+	data, err := json.Marshal(journal{Tasks: tasks, Jobs: jobs})
+	if err != nil {
+		return fmt.Errorf("failed to marshal queue: %w", err)
+	}
+	if err = utils.WriteFileAtomic(journalPath, data); err != nil {
+		return fmt.Errorf("failed to dump queue: %w", err)
+	}
+	s.log.Info("dumping queue done")
+	return nil
+}
+
+// unfinishedJobs returns jobs, which have images in processing.
+func (s *Service) unfinishedJobs() []journalJob {
+	s.jobsMU.RLock()
+	defer s.jobsMU.RUnlock()
+	jobs := make([]journalJob, 0)
+	for _, j := range s.jobs {
+		status := s.jobStatus(j, nil)
+		if status.Status != entities.ResizeResultStatusProcessing {
+			continue
+		}
+		images := make([]journalJobImage, 0, len(j.images))
+		for i, image := range j.images {
+			saved := journalJobImage{SourceURL: image.sourceURL, ImageID: image.imageID, URL: image.url}
+			if imageStatus := status.Images[i]; imageStatus.Result != entities.ResizeResultStatusProcessing {
+				saved.Status = &imageStatus
+			}
+			images = append(images, saved)
+		}
+		jobs = append(jobs, journalJob{ID: j.id, CallbackURL: j.callbackURL, CreatedAt: j.createdAt, Images: images})
+	}
+	return jobs
+}
+
+// restoreQueue loads tasks from journal file and puts them back to queue.
+// Jobs are registered again and their callbacks are armed, when tasks are restored.
+// Journal is removed after loading, so tasks are not restored twice.
+func (s *Service) restoreQueue() {
+	journalPath := s.config().JournalPath
+	if journalPath == "" {
+		return
+	}
+	data, err := os.ReadFile(journalPath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			s.log.Error("failed to read queue journal", err)
+		}
+		return
+	}
+	var saved journal
+	if err = json.Unmarshal(data, &saved); err != nil {
+		s.log.Error("failed to parse queue journal, skip it", err)
+		saved = journal{}
+	}
+	s.log.Info("restoring queue", zap.Int("tasks", len(saved.Tasks)), zap.Int("jobs", len(saved.Jobs)))
+	restored := make([]*task, 0, len(saved.Tasks))
+	for _, t := range saved.Tasks {
+		restored = append(restored, &task{
+			url:        t.URL,
+			imageID:    t.ImageID,
+			params:     t.Params,
+			priority:   t.Priority,
+			clientID:   t.ClientID,
+			revalidate: t.Revalidate,
+		})
+	}
+	// tasks were accepted before restart, so they are restored even if queue capacity is exceeded
+	s.imageStatusMU.Lock()
+	s.queue.Restore(s.registerTasks(s.log, restored)...)
+	s.imageStatusMU.Unlock()
+
+	s.jobsMU.Lock()
+	s.imageStatusMU.RLock()
+	for _, j := range saved.Jobs {
+		images := make([]jobImage, 0, len(j.Images))
+		for _, image := range j.Images {
+			restoredImage := jobImage{sourceURL: image.SourceURL, imageID: image.ImageID, url: image.URL, finished: image.Status}
+			if image.Status == nil {
+				restoredImage.status = s.imageStatus[image.ImageID]
+			}
+			images = append(images, restoredImage)
+		}
+		s.putJob(&job{id: j.ID, callbackURL: j.CallbackURL, createdAt: j.CreatedAt, images: images})
+	}
+	s.imageStatusMU.RUnlock()
+	s.jobsMU.Unlock()
+	if err = os.Remove(journalPath); err != nil {
+		s.log.Error("failed to remove queue journal", err)
+	}
+}
@@ -8,21 +8,57 @@ import (
 )
 
 // processAsync receive request and put it to queue. It will return immediately with status "processing".
-func (s *Service) processAsync(_ context.Context, request *entities.ResizeRequest) ([]entities.ResizeResult, error) {
-	log := s.log.With(zap.Uint("width", request.Width)).
-		With(zap.Uint("height", request.Height))
+// If queue has no capacity for request images, ErrQueueFull or ErrClientQueueFull is returned.
+// Callback url, which points to internal network, is rejected by webhook.ErrCallbackNotAllowed,
+// any callback url is rejected by ErrCallbacksDisabled, if service has no notifier.
+// All images of request are registered as job, so their progress can be checked by job id.
+// Urls of images are built before processing, so they have requested format or jpeg, job reports urls of processed images.
+// If request has callback url, results are posted to it when all images are done.
+func (s *Service) processAsync(ctx context.Context, request *entities.ResizeRequest) (entities.ResizeResponse, error) {
+	if request.CallbackURL != "" {
+		if s.notifier == nil {
+			return entities.ResizeResponse{}, ErrCallbacksDisabled
+		}
+		if err := s.notifier.CheckURL(ctx, request.CallbackURL); err != nil {
+			return entities.ResizeResponse{}, err
+		}
+	}
+	jobID, err := newJobID()
+	if err != nil {
+		return entities.ResizeResponse{}, err
+	}
+	params := request.Params()
+	log := s.log.With(zap.Any("params", params)).With(zap.String("jobID", jobID))
 
 	results := make([]entities.ResizeResult, 0, len(request.URLs))
+	images := make([]jobImage, 0, len(request.URLs))
+	tasks := make([]*task, 0, len(request.URLs))
 	for _, url := range request.URLs {
-		imageID := s.generateKey(url, request.Width, request.Height)
-		newURL := s.imageURL(imageID)
+		imageID := s.generateKey(url, params)
+		newURL := s.imageURL(imageID, outputFormat(params), false)
 		results = append(results, entities.ResizeResult{
 			URL:    newURL,
 			Result: entities.ResizeResultStatusProcessing,
 			Cached: true,
 		})
-		jobLog := log.With(zap.String("url", url)).With(zap.String("imageID", imageID))
-		s.handleNewJob(jobLog, url, imageID, request.Width, request.Height)
+		images = append(images, jobImage{sourceURL: url, imageID: imageID, url: newURL})
+		tasks = append(tasks, &task{
+			url:      url,
+			imageID:  imageID,
+			params:   params,
+			priority: request.Priority,
+			clientID: request.ClientID,
+
+			revalidate: request.Revalidate,
+		})
+	}
+	containers, err := s.handleNewJobs(log, tasks)
+	if err != nil {
+		return entities.ResizeResponse{}, err
+	}
+	for i := range images {
+		images[i].status = containers[i]
 	}
-	return results, nil
+	s.addJob(jobID, request.CallbackURL, images)
+	return entities.ResizeResponse{JobID: jobID, Results: results}, nil
 }
@@ -2,19 +2,22 @@ package orchestrator
 
 import (
 	"context"
+	"errors"
 	"interview-fm-backend/internal/entities"
 	"interview-fm-backend/internal/logger"
+	"interview-fm-backend/internal/service/fetch"
 	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
 
 // processSync receive request and process it synchronously. It will return only after all images are processed.
-func (s *Service) processSync(ctx context.Context, request *entities.ResizeRequest) ([]entities.ResizeResult, error) {
+func (s *Service) processSync(ctx context.Context, request *entities.ResizeRequest) (entities.ResizeResponse, error) {
+	params := request.Params()
 	log := s.log.With(zap.Any("request", request)).
 		With(zap.String("source", "request")).
-		With(zap.Uint("width", request.Width)).
-		With(zap.Uint("height", request.Height))
+		With(zap.Any("params", params))
 
 	log.Info("processing synchronous resizes")
 
@@ -22,11 +25,17 @@ func (s *Service) processSync(ctx context.Context, request *entities.ResizeReque
 	wg.Add(len(request.URLs))
 	res := make(chan entities.ResizeResult, len(request.URLs))
 	for _, url := range request.URLs {
-		<-s.maxSyncImagesRequests // this will protect from too many parallel requests
+		// this will protect from too many parallel requests and from taking all slots by single client
+		if err := s.syncSlots.Acquire(ctx, request.ClientID); err != nil {
+			res <- entities.ResizeResult{Result: entities.ResizeResultStatusFailure, Error: publicError(err)}
+			wg.Done()
+			continue
+		}
 		go func(imageURL string) {
-			res <- s.processURL(ctx, log.With(zap.String("url", imageURL)), imageURL, request.Width, request.Height)
+			result, _ := s.processURL(ctx, log.With(zap.String("url", imageURL)), imageURL, params, request.Revalidate)
+			res <- result
 			wg.Done()
-			s.maxSyncImagesRequests <- struct{}{} // release slot
+			s.syncSlots.Release(request.ClientID) // release slot
 		}(url)
 	}
 	wg.Wait()
@@ -35,35 +44,124 @@ func (s *Service) processSync(ctx context.Context, request *entities.ResizeReque
 	for result := range res {
 		results = append(results, result)
 	}
-	return results, nil
+	return entities.ResizeResponse{Results: results}, nil
+}
+
+// processURL process single image in separate goroutine and put result to channel.
+// Identical processing, which is already in progress for other sync request or async task, is joined instead of
+// starting new one. Request with revalidation doesn't join processing without it.
+// Time, when image should be revalidated, is returned with result, zero if it is not limited.
+func (s *Service) processURL(
+	ctx context.Context,
+	log logger.AppLogger,
+	url string,
+	params entities.ResizeParams,
+	revalidate bool,
+) (entities.ResizeResult, time.Time) {
+	imageID := s.generateKey(url, params)
+	key := imageID
+	if revalidate {
+		key += "_revalidate"
+	}
+	result, expiresAt, shared := s.flights.do(ctx, key, func(ctx context.Context) (entities.ResizeResult, time.Time) {
+		return s.processImage(ctx, log, url, imageID, params, revalidate)
+	})
+	if shared {
+		log.Info("joined processing of image by other request", zap.String("result", string(result.Result)))
+	}
+	return result, expiresAt
 }
 
-// processURL process single image in separate goroutine and put result to channel
-// if image already in cache - it just return it.
+// processImage process single image.
+// if image already in cache - it just return it, unless its source should be revalidated by request or expiry.
+// Cached image without metadata is processed again, as it is unknown when its source should be revalidated.
+// Revalidation is conditional request, image is resized again only if source is changed.
 // else - make request to download data, resize it and put to cache
-func (s *Service) processURL(ctx context.Context, log logger.AppLogger, url string, width, height uint) entities.ResizeResult {
-	imageID := s.generateKey(url, width, height)
-	newURL := s.imageURL(imageID)
+func (s *Service) processImage(
+	ctx context.Context,
+	log logger.AppLogger,
+	url, imageID string,
+	params entities.ResizeParams,
+	revalidate bool,
+) (entities.ResizeResult, time.Time) {
 
-	if s.cache.Contains(imageID) {
-		log.Info("image already in cache")
-		return entities.ResizeResult{
-			URL:    newURL,
+	cached, err := s.cache.Contains(ctx, imageID)
+	if err != nil {
+		// cache is not available, but image still can be processed
+		log.Error("failed to check image in cache", err)
+	}
+	var (
+		previous     imageMetadata
+		cachedResult entities.ResizeResult
+	)
+	if cached {
+		var known bool
+		previous, known = s.loadMetadata(ctx, log, imageID)
+		if previous.Format == "" {
+			previous.Format = outputFormat(params)
+		}
+		cachedResult = entities.ResizeResult{
+			URL:    s.imageURL(imageID, previous.Format, true),
 			Result: entities.ResizeResultStatusSuccess,
 			Cached: true,
 		}
+		switch {
+		case !known:
+			log.Info("image in cache without metadata, processing it again")
+		case !revalidate && !previous.expired(time.Now()):
+			log.Info("image already in cache")
+			return cachedResult, previous.ExpiresAt
+		default:
+			log.Info("image in cache, revalidating source")
+		}
+	} else {
+		log.Info("image not in cache, fetching and resizing")
 	}
 
-	log.Info("image not in cache, fetching and resizing")
-	data, err := s.fetchAndResize(ctx, url, width, height)
+	// cached image gets here only when it is revalidated, explicitly or by expiry
+	data, format, resp, err := s.fetchAndResize(ctx, url, params, previous.fetchValidators(), revalidate || cached)
 	if err != nil {
-		log.Error("failed to fetch and resize image", err)
-		return entities.ResizeResult{Result: entities.ResizeResultStatusFailure}
+		if cached {
+			// source is not available, cached image is still better than nothing
+			log.Error("failed to revalidate image, serving cached one", err, zap.Int("attempts", resp.Attempts))
+			cachedResult.Attempts = resp.Attempts
+			return cachedResult, previous.ExpiresAt
+		}
+		log.Error("failed to fetch and resize image", err, zap.Int("attempts", resp.Attempts))
+		return entities.ResizeResult{Result: entities.ResizeResultStatusFailure, Error: publicError(err), Attempts: resp.Attempts}, time.Time{}
+	}
+	if resp.NotModified {
+		log.Info("source image not modified, keeping cached image")
+		metadata := metadataOf(resp, previous.Format)
+		s.storeMetadata(ctx, log, imageID, metadata)
+		cachedResult.Attempts = resp.Attempts
+		return cachedResult, metadata.ExpiresAt
 	}
-	s.cache.Add(imageID, data)
+	if err = s.cache.Add(ctx, imageID, data); err != nil {
+		log.Error("failed to save image to cache", err)
+		return entities.ResizeResult{Result: entities.ResizeResultStatusFailure, Error: "failed to save image", Attempts: resp.Attempts}, time.Time{}
+	}
+	metadata := metadataOf(resp, format)
+	s.storeMetadata(ctx, log, imageID, metadata)
 	return entities.ResizeResult{
-		URL:    newURL,
-		Result: entities.ResizeResultStatusSuccess,
-		Cached: false,
+		URL:      s.imageURL(imageID, format, true),
+		Result:   entities.ResizeResultStatusSuccess,
+		Cached:   false,
+		Attempts: resp.Attempts,
+	}, metadata.ExpiresAt
+}
+
+// publicError returns stable failure reason, which is given to clients and callbacks.
+// Details of error can expose internal addresses or responses of sources, so they are only logged.
+func publicError(err error) string {
+	var fetchErr *fetch.Error
+	switch {
+	case errors.As(err, &fetchErr):
+		return "failed to fetch image: " + string(fetchErr.Class)
+	case errors.Is(err, context.DeadlineExceeded):
+		return "processing timed out"
+	case errors.Is(err, context.Canceled):
+		return "processing canceled"
 	}
+	return "failed to resize image"
 }
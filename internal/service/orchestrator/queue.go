@@ -0,0 +1,373 @@
+package orchestrator
+
+import (
+	"container/list"
+	"errors"
+	"interview-fm-backend/internal/entities"
+	"sync"
+)
+
+var (
+	// ErrQueueFull is returned when async queue has no capacity for new tasks.
+	ErrQueueFull = errors.New("async queue is full")
+	// ErrClientQueueFull is returned when client has too many tasks waiting in async queue.
+	ErrClientQueueFull = errors.New("too many queued images for client")
+	// ErrCallbacksDisabled is returned for request with callback url, when webhook notifier is not configured.
+	ErrCallbacksDisabled = errors.New("callbacks are disabled")
+)
+
+// laneWeights are shares of processing slots given to priority lanes, when all of them have tasks.
+// Lanes are listed from highest priority, first lane wins when shares are equal.
+var laneWeights = []struct {
+	priority entities.Priority
+	weight   int
+}{
+	{entities.PriorityHigh, 6},
+	{entities.PriorityNormal, 3},
+	{entities.PriorityLow, 1},
+}
+
+// laneClient is FIFO of client tasks in single lane.
+type laneClient struct {
+	id    string
+	tasks *list.List
+	ring  *list.Element // element in lane.clients
+}
+
+type lane struct {
+	priority entities.Priority
+	weight   int
+	current  int        // current share of smooth weighted round-robin
+	clients  *list.List // clients with tasks in round-robin order
+	byID     map[string]*laneClient
+	size     int
+}
+
+// taskQueue is queue of async tasks with priority lanes and bounded total and per client capacity.
+// Lanes are served by smooth weighted round-robin, so low priority tasks are processed even if high priority lane
+// is never empty. Clients of lane are served in round-robin order, tasks of single client are processed in FIFO order.
+// Client can't have more than perClient tasks in processing, its next tasks wait, while others are served.
+// Pop blocks until task is available or queue is closed, so worker wakes up immediately on new tasks.
+type taskQueue struct {
+	mu             sync.Mutex
+	cond           *sync.Cond
+	lanes          []*lane
+	size           int
+	capacity       int
+	clientCapacity int            // max queued tasks of single client
+	perClient      int            // max tasks of single client in processing
+	queued         map[string]int // queued tasks by client
+	processing     map[string]int // tasks in processing by client
+	closed         bool
+}
+
+func newTaskQueue(capacity, clientCapacity, perClient int) *taskQueue {
+	q := &taskQueue{
+		capacity:       capacity,
+		clientCapacity: clientCapacity,
+		perClient:      perClient,
+		queued:         map[string]int{},
+		processing:     map[string]int{},
+	}
+	q.cond = sync.NewCond(&q.mu)
+	for _, w := range laneWeights {
+		q.lanes = append(q.lanes, &lane{
+			priority: w.priority,
+			weight:   w.weight,
+			clients:  list.New(),
+			byID:     map[string]*laneClient{},
+		})
+	}
+	return q
+}
+
+// SetLimits changes capacity of queue and processing limit of client.
+// Tasks already in queue are kept, even if there are more of them than new capacity.
+func (q *taskQueue) SetLimits(capacity, clientCapacity, perClient int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.capacity = capacity
+	q.clientCapacity = clientCapacity
+	q.perClient = perClient
+	q.cond.Broadcast()
+}
+
+// lane returns lane of task priority. Unknown and empty priorities use normal lane.
+func (q *taskQueue) lane(priority entities.Priority) *lane {
+	return q.lanes[laneIndex(priority)]
+}
+
+// laneIndex returns index of priority lane, lower index is higher priority. Unknown and empty priorities use normal lane.
+func laneIndex(priority entities.Priority) int {
+	for i, w := range laneWeights {
+		if w.priority == priority {
+			return i
+		}
+	}
+	return laneIndex(entities.PriorityNormal)
+}
+
+// higherPriority checks if priority p is served by higher lane than other.
+func higherPriority(p, other entities.Priority) bool {
+	return laneIndex(p) < laneIndex(other)
+}
+
+// client returns client tasks in lane, client is added to the end of round-robin order if it had no tasks.
+func (l *lane) client(clientID string) *laneClient {
+	client, ok := l.byID[clientID]
+	if !ok {
+		client = &laneClient{id: clientID, tasks: list.New()}
+		client.ring = l.clients.PushBack(client)
+		l.byID[clientID] = client
+	}
+	return client
+}
+
+// Push adds tasks to the end of their lanes. Either all tasks are added, or none if queue has no capacity for them.
+func (q *taskQueue) Push(tasks ...*task) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.size+len(tasks) > q.capacity {
+		return ErrQueueFull
+	}
+	perClient := map[string]int{}
+	for _, t := range tasks {
+		perClient[t.clientID]++
+	}
+	for clientID, count := range perClient {
+		if q.queued[clientID]+count > q.clientCapacity {
+			return ErrClientQueueFull
+		}
+	}
+	q.pushBack(tasks)
+	return nil
+}
+
+// Restore adds tasks to the end of their lanes without capacity check.
+// It is used for tasks, which were accepted before, like ones restored from journal.
+func (q *taskQueue) Restore(tasks ...*task) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pushBack(tasks)
+}
+
+func (q *taskQueue) pushBack(tasks []*task) {
+	for _, t := range tasks {
+		l := q.lane(t.priority)
+		l.client(t.clientID).tasks.PushBack(t)
+		l.size++
+		q.queued[t.clientID]++
+	}
+	q.size += len(tasks)
+	q.cond.Broadcast()
+}
+
+// Requeue returns interrupted task to the front of its client tasks without capacity check.
+// Task is still counted as processing until Done is called.
+func (q *taskQueue) Requeue(t *task) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	l := q.lane(t.priority)
+	l.client(t.clientID).tasks.PushFront(t)
+	l.size++
+	q.queued[t.clientID]++
+	q.size++
+	q.cond.Broadcast()
+}
+
+// Promote moves queued task of image to the end of its client tasks in lane of higher priority.
+// Task keeps its client, so capacity of queue and clients is not changed.
+// It returns false, if task is not queued or its lane is not lower than priority.
+func (q *taskQueue) Promote(imageID string, priority entities.Priority) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	target := laneIndex(priority)
+	for _, l := range q.lanes[target+1:] {
+		for ring := l.clients.Front(); ring != nil; ring = ring.Next() {
+			client, ok := ring.Value.(*laneClient)
+			if !ok {
+				continue
+			}
+			for e := client.tasks.Front(); e != nil; e = e.Next() {
+				if t, ok := e.Value.(*task); ok && t.imageID == imageID {
+					client.tasks.Remove(e)
+					if client.tasks.Len() == 0 {
+						l.clients.Remove(client.ring)
+						delete(l.byID, client.id)
+					}
+					l.size--
+					t.priority = priority
+					q.lanes[target].client(t.clientID).tasks.PushBack(t)
+					q.lanes[target].size++
+					q.cond.Broadcast()
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Pop removes next task from queue, waiting for it if queue has no tasks available for processing.
+// Task should be marked by Done after processing. Pop returns false when queue is closed.
+func (q *taskQueue) Pop() (*task, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if q.closed {
+			return nil, false
+		}
+		available := make([]int, len(q.lanes))
+		current := make([]int, len(q.lanes))
+		for i, l := range q.lanes {
+			if q.nextClient(l, q.processing) != nil {
+				available[i] = 1
+			}
+			current[i] = l.current
+		}
+		if next := q.next(available, current); next != -1 {
+			for i, l := range q.lanes {
+				l.current = current[i]
+			}
+			return q.take(q.lanes[next]), true
+		}
+		q.cond.Wait()
+	}
+}
+
+// take removes first task of next client of lane and moves client to the end of round-robin order.
+func (q *taskQueue) take(l *lane) *task {
+	client := q.nextClient(l, q.processing)
+	t, _ := client.tasks.Remove(client.tasks.Front()).(*task)
+	l.clients.Remove(client.ring)
+	if client.tasks.Len() == 0 {
+		delete(l.byID, client.id)
+	} else {
+		client.ring = l.clients.PushBack(client)
+	}
+	l.size--
+	q.size--
+	if q.queued[t.clientID]--; q.queued[t.clientID] == 0 {
+		delete(q.queued, t.clientID)
+	}
+	q.processing[t.clientID]++
+	return t
+}
+
+// nextClient returns first client of lane in round-robin order, which has not reached processing limit.
+func (q *taskQueue) nextClient(l *lane, processing map[string]int) *laneClient {
+	for e := l.clients.Front(); e != nil; e = e.Next() {
+		if client, ok := e.Value.(*laneClient); ok && processing[client.id] < q.perClient {
+			return client
+		}
+	}
+	return nil
+}
+
+// next selects lane by smooth weighted round-robin and updates current shares.
+// Only lanes with available tasks take part in selection, -1 is returned if there are no such lanes.
+// Shares of other lanes are reset, so lane does not get burst of slots, when tasks are available in it again.
+func (q *taskQueue) next(available, current []int) int {
+	next, total := -1, 0
+	for i, l := range q.lanes {
+		if available[i] == 0 {
+			current[i] = 0
+			continue
+		}
+		current[i] += l.weight
+		total += l.weight
+		if next == -1 || current[i] > current[next] {
+			next = i
+		}
+	}
+	if next != -1 {
+		current[next] -= total
+	}
+	return next
+}
+
+// Done marks task returned by Pop as processed, so next task of the same client can be taken.
+func (q *taskQueue) Done(t *task) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.processing[t.clientID]--; q.processing[t.clientID] <= 0 {
+		delete(q.processing, t.clientID)
+	}
+	q.cond.Broadcast()
+}
+
+// Close wakes up waiting Pop calls. Tasks stay in queue, so they can be stored to journal.
+func (q *taskQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+func (q *taskQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+// Processing returns count of tasks taken by Pop and not marked by Done yet.
+func (q *taskQueue) Processing() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	processing := 0
+	for _, count := range q.processing {
+		processing += count
+	}
+	return processing
+}
+
+// LaneLengths returns count of tasks waiting in each lane.
+func (q *taskQueue) LaneLengths() map[entities.Priority]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	lengths := make(map[entities.Priority]int, len(q.lanes))
+	for _, l := range q.lanes {
+		lengths[l.priority] = l.size
+	}
+	return lengths
+}
+
+// Tasks returns copy of queued tasks in expected processing order. It simulates Pop calls without changing queue,
+// processing limits of clients are not taken into account, because it is unknown when current tasks are done.
+func (q *taskQueue) Tasks() []*task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	type simulatedClient struct {
+		next      *list.Element
+		remaining int
+	}
+	available := make([]int, len(q.lanes))
+	current := make([]int, len(q.lanes))
+	rings := make([][]*simulatedClient, len(q.lanes))
+	for i, l := range q.lanes {
+		available[i] = l.size
+		current[i] = l.current
+		for e := l.clients.Front(); e != nil; e = e.Next() {
+			if client, ok := e.Value.(*laneClient); ok {
+				rings[i] = append(rings[i], &simulatedClient{next: client.tasks.Front(), remaining: client.tasks.Len()})
+			}
+		}
+	}
+
+	tasks := make([]*task, 0, q.size)
+	for n := 0; n < q.size; n++ {
+		next := q.next(available, current)
+		client := rings[next][0]
+		if t, ok := client.next.Value.(*task); ok {
+			tasks = append(tasks, t)
+		}
+		client.next = client.next.Next()
+		client.remaining--
+		available[next]--
+		rings[next] = rings[next][1:]
+		if client.remaining > 0 {
+			rings[next] = append(rings[next], client)
+		}
+	}
+	return tasks
+}
@@ -1,106 +1,172 @@
 package orchestrator
 
 import (
-	"container/list"
 	"context"
+	"errors"
 	"fmt"
 	"interview-fm-backend/internal/entities"
 	"interview-fm-backend/internal/logger"
 	"interview-fm-backend/internal/service/fetch"
 	"interview-fm-backend/internal/service/resize"
+	"interview-fm-backend/internal/service/webhook"
 	"interview-fm-backend/internal/storage/cache"
 	"interview-fm-backend/internal/utils"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
 )
 
-const (
-	MaxAllowedRequests      = 10
-	MaxAsyncAllowedRequests = 10
-)
+type Config struct {
+	BaseURL     string // url of service, which serves images
+	JournalPath string // file to store pending async tasks on shutdown, empty disables journal
+
+	MaxSyncRequests  int // max parallel sync processing
+	MaxAsyncRequests int // max parallel async processing
+	MaxQueueSize     int // max async tasks waiting in queue, new requests are rejected when it is full
+
+	MaxClientSyncRequests  int // max parallel sync processing of single client
+	MaxClientAsyncRequests int // max parallel async processing of single client
+	MaxClientQueueSize     int // max async tasks of single client waiting in queue
+
+	TaskTimeout      time.Duration // timeout of single async image processing
+	ImageWaitTimeout time.Duration // how long image request waits for async processing of image
+
+	SourceCacheSize int64         // max bytes of downloaded source images kept for resizing to other sizes, 0 disables it
+	SourceCacheTTL  time.Duration // how long source image without `max-age` is used without requests to source
+}
 
 type imageStatusContainer struct {
-	status entities.ResizeResultStatus
-	signal chan struct{}
+	status     entities.ResizeResultStatus
+	signal     chan struct{}
+	err        string            // failure reason
+	attempts   int               // downloads of source image
+	expiresAt  time.Time         // when source of processed image should be revalidated, zero if not limited
+	priority   entities.Priority // highest priority image is requested with, while it is processing
+	queuedAt   time.Time
+	startedAt  time.Time
+	finishedAt time.Time
+	url        string // url of processed image, its format is known only after processing
+	// requestedAt is last time image was requested by async request, finished entry is kept for jobTTL after it
+	requestedAt time.Time
 }
 
 type Service struct {
-	baseURL                string
-	cache                  cache.Cacher
-	log                    logger.AppLogger
-	resizer                resize.Resizer
-	fetcherService         fetch.Fetcher
-	maxSyncImagesRequests  chan struct{} // how much parallel execution allowed
-	maxAsyncImagesRequests chan struct{} // how much parallel execution allowed for async processing
+	cfg            Config
+	cfgMU          sync.RWMutex
+	cache          cache.Cacher
+	log            logger.AppLogger
+	resizer        resize.Resizer
+	fetcherService fetch.Fetcher
+	sources        *sourceCache     // source images, consulted before fetcherService
+	flights        *flightGroup     // images in processing, shared by identical requests
+	notifier       webhook.Notifier // delivers results of async jobs with callback url
+	syncSlots      *clientSlots     // how much parallel execution allowed, in total and for each client
+	asyncSlots     *clientSlots     // how much parallel execution allowed for async processing
 
-	queue   *list.List // list of tasks to process in async
-	queueMU sync.Mutex
+	queue    *taskQueue // tasks to process in async
+	rejected uint64     // async requests rejected because queue was full
 
 	imageStatus   map[string]*imageStatusContainer // map of imageID to trace status
 	imageStatusMU sync.RWMutex
 
+	jobs      map[string]*job // map of jobID to async request images
+	jobsMU    sync.RWMutex
+	callbacks sync.WaitGroup // pending job callbacks
+
 	ctx        context.Context // context for graceful shutdown
 	cancel     context.CancelFunc
 	workerDone chan struct{} // channel to notify that background worker is done and service stopped
 }
 
-func NewService(baseURL string, resizer resize.Resizer, fetcherService fetch.Fetcher, cache cache.Cacher, log logger.AppLogger) *Service {
+// NewService creates orchestrator and starts background worker.
+// If cfg.JournalPath is set, async tasks which were not processed before previous shutdown are restored from it.
+// Notifier can be nil, than async requests with callback url are rejected by ErrCallbacksDisabled.
+func NewService(
+	cfg Config,
+	resizer resize.Resizer,
+	fetcherService fetch.Fetcher,
+	notifier webhook.Notifier,
+	cache cache.Cacher,
+	log logger.AppLogger,
+) *Service {
 	srv := &Service{
-		resizer:                resizer,
-		fetcherService:         fetcherService,
-		cache:                  cache,
-		baseURL:                baseURL,
-		log:                    log.With(zap.String("service", "resize")),
-		maxSyncImagesRequests:  make(chan struct{}, MaxAllowedRequests),
-		maxAsyncImagesRequests: make(chan struct{}, MaxAsyncAllowedRequests),
+		resizer:        resizer,
+		fetcherService: fetcherService,
+		sources:        newSourceCache(cfg.SourceCacheSize, cfg.SourceCacheTTL),
+		flights:        newFlightGroup(),
+		notifier:       notifier,
+		cache:          cache,
+		cfg:            cfg,
+		log:            log.With(zap.String("service", "resize")),
+		syncSlots:      newClientSlots(cfg.MaxSyncRequests, cfg.MaxClientSyncRequests),
+		// limit of single client is applied by queue
+		asyncSlots: newClientSlots(cfg.MaxAsyncRequests, cfg.MaxAsyncRequests),
 
-		queue:   list.New(),
-		queueMU: sync.Mutex{},
+		queue: newTaskQueue(cfg.MaxQueueSize, cfg.MaxClientQueueSize, cfg.MaxClientAsyncRequests),
 
 		imageStatus:   map[string]*imageStatusContainer{},
 		imageStatusMU: sync.RWMutex{},
+		jobs:          map[string]*job{},
+		jobsMU:        sync.RWMutex{},
 		workerDone:    make(chan struct{}),
 	}
-	for i := 0; i < MaxAllowedRequests; i++ {
-		srv.maxSyncImagesRequests <- struct{}{}
-	}
-	for i := 0; i < MaxAsyncAllowedRequests; i++ {
-		srv.maxAsyncImagesRequests <- struct{}{}
-	}
-
 	srv.ctx, srv.cancel = context.WithCancel(context.Background())
+	srv.restoreQueue()
 	go srv.worker()
 	return srv
 }
 
 // ProcessResizes process resize requests in sync or async mode, depending from `async` flag.
-func (s *Service) ProcessResizes(ctx context.Context, request *entities.ResizeRequest, async bool) ([]entities.ResizeResult, error) {
+func (s *Service) ProcessResizes(ctx context.Context, request *entities.ResizeRequest, async bool) (entities.ResizeResponse, error) {
 	if async {
 		return s.processAsync(ctx, request)
 	}
 	return s.processSync(ctx, request)
 }
 
-func (s *Service) fetchAndResize(ctx context.Context, url string, width, height uint) ([]byte, error) {
-	data, err := s.fetcherService.Fetch(ctx, url)
+// fetchAndResize downloads and resizes image. If source is not modified since validators, nothing is resized.
+// If revalidate is set, source is checked by request, even if it is fresh in source cache.
+// Response is returned even if processing failed, so count of download attempts is known.
+func (s *Service) fetchAndResize(
+	ctx context.Context,
+	url string,
+	params entities.ResizeParams,
+	validators fetch.Validators,
+	revalidate bool,
+) ([]byte, entities.ImageFormat, fetch.Response, error) {
+	resp, err := s.fetchSource(ctx, url, validators, revalidate)
 	if err != nil {
-		return nil, err
+		var fetchErr *fetch.Error
+		if errors.As(err, &fetchErr) {
+			return nil, "", fetch.Response{Attempts: fetchErr.Attempts}, err
+		}
+		return nil, "", fetch.Response{}, err
+	}
+	if resp.NotModified {
+		return nil, "", resp, nil
 	}
-	return s.resizer.ResizeImage(data, width, height)
+	data, format, err := s.resizer.ResizeImage(resp.Data, params)
+	return data, format, resp, err
 }
 
-// GetImage in current realization just returns image from in-memory.
-// for future enhancement added context, in case expected network request for external cache service.
+// GetImage returns image from cache, which can be in-memory or external cache service.
 // If image not found in cache - than also check in imageStatus map. If failed - serve 404 error.
 // Then start wait for end of processing.
 func (s *Service) GetImage(ctx context.Context, imageID string) ([]byte, bool, error) {
 	log := s.log.With(zap.String("method", "GetImage")).With(zap.String("image_id", imageID))
 	log.Info("getting image")
-	if s.cache.Contains(imageID) {
-		imgData, ok := s.cache.Get(imageID)
-		return imgData, ok, nil
+	if strings.HasSuffix(imageID, metadataSuffix) {
+		return nil, false, nil
+	}
+	cached, err := s.cache.Contains(ctx, imageID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to check image in cache: %w", err)
+	}
+	if cached {
+		return s.cache.Get(ctx, imageID)
 	}
 	log.Info("image not found in cache")
 	s.imageStatusMU.RLock()
@@ -116,16 +182,19 @@ func (s *Service) GetImage(ctx context.Context, imageID string) ([]byte, bool, e
 	}
 	log.Info("image is processing, wait to finish")
 
-	ctxT, cancel := context.WithTimeout(ctx, 30*time.Second)
+	ctxT, cancel := context.WithTimeout(ctx, s.config().ImageWaitTimeout)
 	defer cancel()
 	for {
 		select {
 		case <-container.signal:
 			log.Info("image processing finished")
-			if s.cache.Contains(imageID) {
+			cached, err = s.cache.Contains(ctx, imageID)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to check image in cache: %w", err)
+			}
+			if cached {
 				log.Info("image found in cache after processing")
-				imgData, ok := s.cache.Get(imageID)
-				return imgData, ok, nil
+				return s.cache.Get(ctx, imageID)
 			}
 			log.Info("image not found in cache after processing")
 			return nil, false, nil
@@ -135,28 +204,100 @@ func (s *Service) GetImage(ctx context.Context, imageID string) ([]byte, bool, e
 	}
 }
 
-// generateKey calculate hash from string, width and height
-// It is allows store in cache same image for different sizes
-func (s *Service) generateKey(url string, width, height uint) string {
-	return utils.GenerateKey(fmt.Sprintf("%s_%d_%d", url, width, height))
+// generateKey calculate hash from string, width, height and encoding params
+// It is allows store in cache same image for different sizes and formats.
+// Params with default values are not added to key, so keys of images resized with defaults are not changed.
+func (s *Service) generateKey(url string, params entities.ResizeParams) string {
+	src := fmt.Sprintf("%s_%d_%d", url, params.Width, params.Height)
+	if params.Format != "" {
+		src += fmt.Sprintf("_f:%s", params.Format)
+	}
+	// quality is applied to requested jpeg only, other formats including format of source don't differ by it
+	if params.Quality != 0 && params.Format == entities.ImageFormatJPEG {
+		src += fmt.Sprintf("_q:%d", params.Quality)
+	}
+	if params.Mode != "" {
+		src += fmt.Sprintf("_m:%s", params.Mode)
+	}
+	if params.Gravity != "" {
+		src += fmt.Sprintf("_g:%s", params.Gravity)
+	}
+	if params.Background != "" {
+		src += fmt.Sprintf("_bg:%s", params.Background)
+	}
+	if params.Interpolation != "" {
+		src += fmt.Sprintf("_i:%s", params.Interpolation)
+	}
+	return utils.GenerateKey(src)
+}
+
+// imageURL builds url for serving image. If image is stored and cache storage can serve images directly - its url is used.
+// Otherwise image is served by this service, which waits for processing of image, if it is not stored yet.
+// Extension is informational only, router detects real content type.
+func (s *Service) imageURL(imageID string, format entities.ImageFormat, stored bool) string {
+	if provider, ok := s.cache.(cache.DirectURLProvider); ok && stored {
+		if directURL, ok := provider.DirectURL(imageID); ok {
+			return directURL
+		}
+	}
+	return fmt.Sprintf("%s/v1/image/%s.%s", s.config().BaseURL, imageID, format.Extension())
+}
+
+// outputFormat returns format of image, which is not processed yet. Real format of image without requested one is
+// known only after processing, but extension of its url is informational only.
+func outputFormat(params entities.ResizeParams) entities.ImageFormat {
+	if params.Format != "" {
+		return params.Format
+	}
+	return entities.ImageFormatJPEG
 }
 
-func (s *Service) imageURL(imageID string) string {
-	return fmt.Sprintf("%s/v1/image/%s.jpg", s.baseURL, imageID)
+// Reload applies new configuration without restart. Processing limits are changed for new images,
+// images in progress are not interrupted, even if there are more of them than new limits allow.
+func (s *Service) Reload(cfg Config) {
+	s.cfgMU.Lock()
+	s.cfg = cfg
+	s.cfgMU.Unlock()
+	s.syncSlots.SetLimits(cfg.MaxSyncRequests, cfg.MaxClientSyncRequests)
+	s.asyncSlots.SetLimits(cfg.MaxAsyncRequests, cfg.MaxAsyncRequests)
+	s.queue.SetLimits(cfg.MaxQueueSize, cfg.MaxClientQueueSize, cfg.MaxClientAsyncRequests)
+	s.sources.setLimits(cfg.SourceCacheSize, cfg.SourceCacheTTL)
+	s.log.Info("config reloaded")
+}
+
+func (s *Service) config() Config {
+	s.cfgMU.RLock()
+	defer s.cfgMU.RUnlock()
+	return s.cfg
+}
+
+// QueueStats returns current usage of async queue.
+func (s *Service) QueueStats() entities.QueueStats {
+	return entities.QueueStats{
+		Depth:      s.queue.Len(),
+		Capacity:   s.config().MaxQueueSize,
+		Processing: s.queue.Processing(),
+		Rejected:   atomic.LoadUint64(&s.rejected),
+		Coalesced:  s.flights.Coalesced(),
+		Waiting:    s.flights.Waiting(),
+		Lanes:      s.queue.LaneLengths(),
+	}
+}
+
+// SourceCacheStats returns usage of source images cache.
+func (s *Service) SourceCacheStats() entities.CacheStats {
+	return s.sources.stats()
 }
 
 // Shutdown gracefully shutdown service.
 // First stop starting new tasks
-// Than wait for current executing tasks are done
-// Than store current queue in dump file and exit
+// Than wait for current executing tasks are done, interrupted tasks are returned to queue
+// Than wait for callbacks of finished jobs, callbacks of unfinished jobs are postponed if journal is enabled
+// Than store current queue and unfinished jobs in journal file and exit
 func (s *Service) Shutdown() error {
 	s.cancel()
+	s.queue.Close()
 	<-s.workerDone
-	s.dumpQueue()
-	return nil
-}
-
-func (s *Service) dumpQueue() {
-	s.log.Info("dumping queue...")
-	s.log.Info("dumping queue done")
+	s.callbacks.Wait()
+	return s.dumpQueue()
 }
@@ -7,7 +7,12 @@ import (
 	"interview-fm-backend/internal/logger"
 	"interview-fm-backend/internal/service/fetch"
 	"interview-fm-backend/internal/service/orchestrator"
+	"interview-fm-backend/internal/service/webhook"
 	"interview-fm-backend/internal/storage/cache"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -20,15 +25,33 @@ type testFetcher struct {
 	injectedFunc func() ([]byte, error)
 }
 
-func (t testFetcher) Fetch(_ context.Context, _ string) ([]byte, error) {
-	return t.injectedFunc()
+func (t testFetcher) Fetch(_ context.Context, _ string, _ fetch.Validators) (fetch.Response, error) {
+	data, err := t.injectedFunc()
+	if err != nil {
+		return fetch.Response{}, &fetch.Error{Class: fetch.ErrorClassInvalid, Attempts: 1, Err: err}
+	}
+	return fetch.Response{Data: data, Attempts: 1}, nil
+}
+
+// blockingFetcher blocks until context is done.
+type blockingFetcher struct {
+	started *uint64
+}
+
+func (b blockingFetcher) Fetch(ctx context.Context, _ string, _ fetch.Validators) (fetch.Response, error) {
+	atomic.AddUint64(b.started, 1)
+	<-ctx.Done()
+	return fetch.Response{}, ctx.Err()
 }
 
 type testResizer struct {
 }
 
-func (t testResizer) ResizeImage(data []byte, _, _ uint) ([]byte, error) {
-	return data, nil
+func (t testResizer) ResizeImage(data []byte, params entities.ResizeParams) ([]byte, entities.ImageFormat, error) {
+	if params.Format != "" {
+		return data, params.Format, nil
+	}
+	return data, entities.ImageFormatJPEG, nil
 }
 
 const (
@@ -39,15 +62,75 @@ const (
 
 var log, _ = logger.NewAppLogger()
 
+var testConfig = orchestrator.Config{
+	BaseURL:                baseURL,
+	MaxSyncRequests:        10,
+	MaxAsyncRequests:       10,
+	MaxQueueSize:           1000,
+	MaxClientSyncRequests:  5,
+	MaxClientAsyncRequests: 5,
+	MaxClientQueueSize:     500,
+	TaskTimeout:            10 * time.Second,
+	ImageWaitTimeout:       30 * time.Second,
+}
+
+// journalConfig returns test config with enabled journal.
+func journalConfig(journal string) orchestrator.Config {
+	cfg := testConfig
+	cfg.JournalPath = journal
+	return cfg
+}
+
+// resizeRequest returns request of count different urls, starting from url with index from.
+func resizeRequest(from, count int) *entities.ResizeRequest {
+	request := &entities.ResizeRequest{
+		URLs:   make([]string, 0, count),
+		Height: 1,
+		Width:  1,
+	}
+	for i := from; i < from+count; i++ {
+		request.URLs = append(request.URLs, fmt.Sprintf("http://localhost:8080/%d/abc", i))
+	}
+	return request
+}
+
+// queuePositions returns queue positions of job images.
+func queuePositions(t *testing.T, service *orchestrator.Service, jobID string) []int {
+	job, ok, err := service.GetJob(context.Background(), jobID)
+	require.NoError(t, err)
+	require.True(t, ok)
+	positions := make([]int, 0, len(job.Images))
+	for _, image := range job.Images {
+		positions = append(positions, image.QueuePosition)
+	}
+	return positions
+}
+
+// occupyWorkers starts async tasks of several clients with blocking fetcher, so next tasks stay in queue.
+func occupyWorkers(t *testing.T, service *orchestrator.Service, started *uint64) []entities.ResizeResult {
+	results := make([]entities.ResizeResult, 0, testConfig.MaxAsyncRequests)
+	for from := 0; from < testConfig.MaxAsyncRequests; from += testConfig.MaxClientAsyncRequests {
+		request := resizeRequest(10000+from, testConfig.MaxClientAsyncRequests)
+		request.ClientID = fmt.Sprintf("worker%d", from)
+		resp, err := service.ProcessResizes(context.Background(), request, true)
+		require.NoError(t, err)
+		results = append(results, resp.Results...)
+	}
+	require.Eventually(t, func() bool {
+		return atomic.LoadUint64(started) == uint64(testConfig.MaxAsyncRequests)
+	}, 4*time.Second, time.Millisecond)
+	return results
+}
+
 func TestService_GetImage(t *testing.T) {
 	t.Run("should return image", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		fetcher := fetch.NewMockFetcher(ctrl)
 		cacheMock := cache.NewMockCacher(ctrl)
 
-		service := orchestrator.NewService(baseURL, testResizer{}, fetcher, cacheMock, log)
-		cacheMock.EXPECT().Contains("123").Return(true)
-		cacheMock.EXPECT().Get(gomock.Any()).Return([]byte("123456"), true)
+		service := orchestrator.NewService(testConfig, testResizer{}, fetcher, nil, cacheMock, log)
+		cacheMock.EXPECT().Contains(gomock.Any(), "123").Return(true, nil)
+		cacheMock.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]byte("123456"), true, nil)
 		res, ok, err := service.GetImage(context.Background(), "123")
 		require.True(t, ok)
 		require.NoError(t, err)
@@ -57,11 +140,13 @@ func TestService_GetImage(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		cacheMock := cache.NewMockCacher(ctrl)
 		fetcher := testFetcher{func() ([]byte, error) {
-			cacheMock.EXPECT().Add(gomock.Any(), gomock.Any()) // check that all started requests are saved to cache before server stopped
+			// check that all started requests are saved to cache with their metadata before server stopped
+			cacheMock.EXPECT().Add(gomock.Any(), gomock.Any(), gomock.Any())
+			cacheMock.EXPECT().Add(gomock.Any(), gomock.Any(), gomock.Any())
 			return []byte("123456"), nil
 		}}
 
-		service := orchestrator.NewService(baseURL, testResizer{}, fetcher, cacheMock, log)
+		service := orchestrator.NewService(testConfig, testResizer{}, fetcher, nil, cacheMock, log)
 		_, err := service.ProcessResizes(context.Background(), &entities.ResizeRequest{
 			URLs:   []string{sampleURL},
 			Height: 1,
@@ -69,9 +154,9 @@ func TestService_GetImage(t *testing.T) {
 		}, true)
 		require.NoError(t, err)
 
-		call := cacheMock.EXPECT().Contains(sampleURLHash).Return(false).Times(2)
-		afterProcessing := cacheMock.EXPECT().Contains(sampleURLHash).Return(true).After(call)
-		cacheMock.EXPECT().Get(sampleURLHash).Return([]byte("123456"), true).After(afterProcessing)
+		call := cacheMock.EXPECT().Contains(gomock.Any(), sampleURLHash).Return(false, nil).Times(2)
+		afterProcessing := cacheMock.EXPECT().Contains(gomock.Any(), sampleURLHash).Return(true, nil).After(call)
+		cacheMock.EXPECT().Get(gomock.Any(), sampleURLHash).Return([]byte("123456"), true, nil).After(afterProcessing)
 
 		res, ok, err := service.GetImage(context.Background(), sampleURLHash)
 		require.NoError(t, err)
@@ -80,6 +165,167 @@ func TestService_GetImage(t *testing.T) {
 	})
 }
 
+func TestService_ProcessResizes(t *testing.T) {
+	t.Run("should generate different images for different output params", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		cacheMock := cache.NewMockCacher(ctrl)
+		cacheMock.EXPECT().Contains(gomock.Any(), gomock.Any()).Return(false, nil).AnyTimes()
+		fetcher := testFetcher{func() ([]byte, error) {
+			return nil, fmt.Errorf("not found")
+		}}
+		service := orchestrator.NewService(testConfig, testResizer{}, fetcher, nil, cacheMock, log)
+
+		requests := []*entities.ResizeRequest{
+			{URLs: []string{sampleURL}, Width: 1, Height: 1},
+			{URLs: []string{sampleURL}, Width: 1, Height: 1, Format: entities.OutputFormatPNG},
+			{URLs: []string{sampleURL}, Width: 1, Height: 1, Format: entities.OutputFormatJPEG, Quality: 60},
+			{URLs: []string{sampleURL}, Width: 1, Height: 1, Format: entities.OutputFormatWebPLossless},
+			{URLs: []string{sampleURL}, Width: 1, Height: 1, Mode: entities.ResizeModeFill, Gravity: entities.GravityNorth},
+			{URLs: []string{sampleURL}, Width: 1, Height: 1, Interpolation: entities.InterpolationBilinear},
+		}
+		urls := make(map[string]struct{}, len(requests))
+		for _, request := range requests {
+			res, err := service.ProcessResizes(context.Background(), request, true)
+			require.NoError(t, err)
+			require.Len(t, res.Results, 1)
+			urls[res.Results[0].URL] = struct{}{}
+		}
+		require.Len(t, urls, len(requests))
+		require.Contains(t, urls, baseURL+"/v1/image/"+sampleURLHash+".jpg")
+
+		// explicit default interpolation should give same image as empty one
+		res, err := service.ProcessResizes(context.Background(), &entities.ResizeRequest{
+			URLs: []string{sampleURL}, Width: 1, Height: 1, Interpolation: entities.InterpolationLanczos3,
+		}, true)
+		require.NoError(t, err)
+		require.Equal(t, baseURL+"/v1/image/"+sampleURLHash+".jpg", res.Results[0].URL)
+
+		// quality is not applied to lossless formats, so it gives same image
+		lossless, err := service.ProcessResizes(context.Background(), &entities.ResizeRequest{
+			URLs: []string{sampleURL}, Width: 1, Height: 1, Format: entities.OutputFormatPNG,
+		}, true)
+		require.NoError(t, err)
+		res, err = service.ProcessResizes(context.Background(), &entities.ResizeRequest{
+			URLs: []string{sampleURL}, Width: 1, Height: 1, Format: entities.OutputFormatPNG, Quality: 60,
+		}, true)
+		require.NoError(t, err)
+		require.Equal(t, lossless.Results[0].URL, res.Results[0].URL)
+		// format of source is unknown before processing, so quality is not applied to it
+		res, err = service.ProcessResizes(context.Background(), &entities.ResizeRequest{
+			URLs: []string{sampleURL}, Width: 1, Height: 1, Quality: 60,
+		}, true)
+		require.NoError(t, err)
+		require.Equal(t, baseURL+"/v1/image/"+sampleURLHash+".jpg", res.Results[0].URL)
+
+		// stretch is name of default mode
+		stretch := &entities.ResizeRequest{URLs: []string{sampleURL}, Width: 1, Height: 1, Mode: "stretch"}
+		require.NoError(t, stretch.Validate())
+		res, err = service.ProcessResizes(context.Background(), stretch, true)
+		require.NoError(t, err)
+		require.Equal(t, baseURL+"/v1/image/"+sampleURLHash+".jpg", res.Results[0].URL)
+		require.NoError(t, service.Shutdown())
+	})
+	t.Run("should process again cached image without metadata", func(t *testing.T) {
+		memoryCache, err := cache.NewCache(1024, "", log)
+		require.NoError(t, err)
+		// metadata is evicted or image is cached by other version of service
+		require.NoError(t, memoryCache.Add(context.Background(), sampleURLHash, []byte("stale")))
+		fetcher := fetch.NewMockFetcher(gomock.NewController(t))
+		fetcher.EXPECT().Fetch(gomock.Any(), sampleURL, fetch.Validators{}).
+			Return(fetch.Response{Data: []byte("fresh"), Attempts: 1, ExpiresAt: time.Now().Add(time.Hour)}, nil)
+		service := orchestrator.NewService(testConfig, testResizer{}, fetcher, nil, memoryCache, log)
+
+		res, err := service.ProcessResizes(context.Background(), resizeRequest(1, 1), false)
+		require.NoError(t, err)
+		require.False(t, res.Results[0].Cached)
+		// metadata is stored again, so next request is served from cache
+		res, err = service.ProcessResizes(context.Background(), resizeRequest(1, 1), false)
+		require.NoError(t, err)
+		require.True(t, res.Results[0].Cached)
+		image, ok, err := service.GetImage(context.Background(), sampleURLHash)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, []byte("fresh"), image)
+		require.NoError(t, service.Shutdown())
+	})
+	t.Run("should keep metadata in disk cache", func(t *testing.T) {
+		disk, err := cache.NewDiskCache(t.TempDir(), 1024, log)
+		require.NoError(t, err)
+		fetcher := fetch.NewMockFetcher(gomock.NewController(t))
+		fetcher.EXPECT().Fetch(gomock.Any(), sampleURL, fetch.Validators{}).
+			Return(fetch.Response{Data: []byte("123456"), Attempts: 1, ExpiresAt: time.Now().Add(time.Hour)}, nil)
+		service := orchestrator.NewService(testConfig, testResizer{}, fetcher, nil, disk, log)
+
+		res, err := service.ProcessResizes(context.Background(), resizeRequest(1, 1), false)
+		require.NoError(t, err)
+		require.False(t, res.Results[0].Cached)
+		// image is not processed again, as its metadata is stored
+		res, err = service.ProcessResizes(context.Background(), resizeRequest(1, 1), false)
+		require.NoError(t, err)
+		require.True(t, res.Results[0].Cached)
+		require.NoError(t, service.Shutdown())
+	})
+	t.Run("should not expose details of failure", func(t *testing.T) {
+		memoryCache, err := cache.NewCache(1024, "", log)
+		require.NoError(t, err)
+		fetcher := fetch.NewMockFetcher(gomock.NewController(t))
+		fetcher.EXPECT().Fetch(gomock.Any(), sampleURL, gomock.Any()).Return(fetch.Response{}, &fetch.Error{
+			Class: fetch.ErrorClassNetwork, Attempts: 1, Err: fmt.Errorf("dial tcp 10.0.0.1:80: connection refused"),
+		})
+		service := orchestrator.NewService(testConfig, testResizer{}, fetcher, nil, memoryCache, log)
+		res, err := service.ProcessResizes(context.Background(), resizeRequest(1, 1), false)
+		require.NoError(t, err)
+		require.Equal(t, entities.ResizeResultStatusFailure, res.Results[0].Result)
+		require.Equal(t, "failed to fetch image: network", res.Results[0].Error)
+		require.NoError(t, service.Shutdown())
+	})
+}
+
+// directURLCache serves images from external storage.
+type directURLCache struct {
+	*cache.LRU
+}
+
+func (d directURLCache) DirectURL(key string) (string, bool) {
+	return "https://cdn.example.com/" + key, true
+}
+
+func TestService_DirectURL(t *testing.T) {
+	memoryCache, err := cache.NewCache(1024, "", log)
+	require.NoError(t, err)
+	fetcher := testFetcher{func() ([]byte, error) {
+		return []byte("123456"), nil
+	}}
+	service := orchestrator.NewService(testConfig, testResizer{}, fetcher, nil, directURLCache{memoryCache}, log)
+	res, err := service.ProcessResizes(context.Background(), &entities.ResizeRequest{
+		URLs:   []string{sampleURL},
+		Height: 1,
+		Width:  1,
+	}, false)
+	require.NoError(t, err)
+	require.Equal(t, []entities.ResizeResult{{
+		Result:   entities.ResizeResultStatusSuccess,
+		URL:      "https://cdn.example.com/" + sampleURLHash,
+		Attempts: 1,
+	}}, res.Results)
+
+	// image, which is not stored yet, is served by service, so request waits for processing
+	res, err = service.ProcessResizes(context.Background(), resizeRequest(2, 1), true)
+	require.NoError(t, err)
+	imageID := strings.TrimSuffix(path.Base(res.Results[0].URL), ".jpg")
+	require.Equal(t, baseURL+"/v1/image/"+imageID+".jpg", res.Results[0].URL)
+	// job reports direct url, when image is stored
+	require.Eventually(t, func() bool {
+		job, _, err := service.GetJob(context.Background(), res.JobID)
+		require.NoError(t, err)
+		return job.Status == entities.ResizeResultStatusSuccess
+	}, 4*time.Second, 10*time.Millisecond)
+	job, _, err := service.GetJob(context.Background(), res.JobID)
+	require.NoError(t, err)
+	require.Equal(t, "https://cdn.example.com/"+imageID, job.Images[0].URL)
+	require.NoError(t, service.Shutdown())
+}
+
 func TestService_Shutdown(t *testing.T) {
 	const imageProcess = 15
 	testTimeout := time.After(5 * time.Second)
@@ -90,30 +336,29 @@ func TestService_Shutdown(t *testing.T) {
 	signalChan := make(chan struct{})
 	fetcher := testFetcher{func() ([]byte, error) {
 		atomic.AddUint64(&requestCounter, 1)
-		cacheMock.EXPECT().Add(gomock.Any(), gomock.Any()) // check that all started requests are saved to cache before server stopped
+		// check that all started requests are saved to cache with their metadata before server stopped
+		cacheMock.EXPECT().Add(gomock.Any(), gomock.Any(), gomock.Any())
+		cacheMock.EXPECT().Add(gomock.Any(), gomock.Any(), gomock.Any())
 		<-signalChan
 		return []byte("123456"), nil
 	}}
-	service := orchestrator.NewService(baseURL, testResizer{}, fetcher, cacheMock, log)
+	service := orchestrator.NewService(testConfig, testResizer{}, fetcher, nil, cacheMock, log)
 
-	request := &entities.ResizeRequest{
-		URLs:   make([]string, 0, imageProcess),
-		Height: 1,
-		Width:  1,
-	}
-	for i := 0; i < imageProcess; i++ {
-		request.URLs = append(request.URLs, fmt.Sprintf("http://localhost:8080/%d/abc", i))
+	cacheMock.EXPECT().Contains(gomock.Any(), gomock.Any()).Return(false, nil).AnyTimes()
+	// images of several clients, so single client limit does not prevent taking all workers
+	for from := 0; from < imageProcess; from += testConfig.MaxClientAsyncRequests {
+		request := resizeRequest(from, testConfig.MaxClientAsyncRequests)
+		request.ClientID = fmt.Sprintf("client%d", from)
+		resp, err := service.ProcessResizes(context.Background(), request, true)
+		require.NoError(t, err)
+		require.True(t, len(resp.Results) == testConfig.MaxClientAsyncRequests)
 	}
-	cacheMock.EXPECT().Contains(gomock.Any()).Return(false).AnyTimes()
-	resp, err := service.ProcessResizes(context.Background(), request, true)
-	require.NoError(t, err)
-	require.True(t, len(resp) == imageProcess)
 
 	doneChan := make(chan struct{})
 
 	go func() {
 		require.Eventually(t, func() bool {
-			if atomic.LoadUint64(&requestCounter) != orchestrator.MaxAsyncAllowedRequests {
+			if atomic.LoadUint64(&requestCounter) != uint64(testConfig.MaxAsyncRequests) {
 				return false
 			}
 			// started maximum of possible background tasks
@@ -131,3 +376,737 @@ func TestService_Shutdown(t *testing.T) {
 		break
 	}
 }
+
+func TestService_QueueJournal(t *testing.T) {
+	journal := filepath.Join(t.TempDir(), "queue.journal")
+
+	// all tasks, both pending and interrupted by shutdown, should be stored in journal
+	started := uint64(0)
+	memoryCache, err := cache.NewCache(1024, "", log)
+	require.NoError(t, err)
+	service := orchestrator.NewService(journalConfig(journal), testResizer{}, blockingFetcher{started: &started}, nil, memoryCache, log)
+	results := occupyWorkers(t, service, &started)
+	resp, err := service.ProcessResizes(context.Background(), resizeRequest(0, 5), true)
+	require.NoError(t, err)
+	results = append(results, resp.Results...)
+	require.NoError(t, service.Shutdown())
+	require.FileExists(t, journal)
+
+	// restarted service should process all tasks
+	fetcher := testFetcher{func() ([]byte, error) {
+		return []byte("123456"), nil
+	}}
+	restarted := orchestrator.NewService(journalConfig(journal), testResizer{}, fetcher, nil, memoryCache, log)
+	require.NoFileExists(t, journal)
+	for _, result := range results {
+		imageID := strings.TrimSuffix(path.Base(result.URL), ".jpg")
+		res, ok, err := restarted.GetImage(context.Background(), imageID)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, []byte("123456"), res)
+	}
+	require.NoError(t, restarted.Shutdown())
+}
+
+func TestService_QueueJournalJobs(t *testing.T) {
+	journal := filepath.Join(t.TempDir(), "queue.journal")
+	const callbackURL = "http://localhost:8081/callback"
+
+	// callback of unfinished job is not sent on shutdown, job is stored in journal
+	ctrl := gomock.NewController(t)
+	notifier := webhook.NewMockNotifier(ctrl)
+	notifier.EXPECT().CheckURL(gomock.Any(), callbackURL).Return(nil)
+	started := uint64(0)
+	memoryCache, err := cache.NewCache(1024, "", log)
+	require.NoError(t, err)
+	service := orchestrator.NewService(journalConfig(journal), testResizer{}, blockingFetcher{started: &started}, notifier, memoryCache, log)
+	occupyWorkers(t, service, &started)
+	request := resizeRequest(0, 2)
+	request.CallbackURL = callbackURL
+	resp, err := service.ProcessResizes(context.Background(), request, true)
+	require.NoError(t, err)
+	require.NoError(t, service.Shutdown())
+
+	// restarted service knows job and sends callback, when its images are done
+	notified := make(chan []entities.ResizeResult, 1)
+	restartedNotifier := webhook.NewMockNotifier(ctrl)
+	restartedNotifier.EXPECT().Notify(gomock.Any(), callbackURL, resp.JobID, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, _, _ string, results []entities.ResizeResult) error {
+			require.NoError(t, ctx.Err())
+			notified <- results
+			return nil
+		})
+	fetcher := testFetcher{func() ([]byte, error) {
+		return []byte("123456"), nil
+	}}
+	restarted := orchestrator.NewService(journalConfig(journal), testResizer{}, fetcher, restartedNotifier, memoryCache, log)
+	select {
+	case results := <-notified:
+		require.Len(t, results, 2)
+		for i, result := range results {
+			require.Equal(t, entities.ResizeResultStatusSuccess, result.Result)
+			require.Equal(t, resp.Results[i].URL, result.URL)
+		}
+	case <-time.After(4 * time.Second):
+		t.Fatal("callback is not sent")
+	}
+	job, ok, err := restarted.GetJob(context.Background(), resp.JobID)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, entities.ResizeResultStatusSuccess, job.Status)
+	require.NoError(t, restarted.Shutdown())
+}
+
+func TestService_GetJob(t *testing.T) {
+	memoryCache, err := cache.NewCache(1024, "", log)
+	require.NoError(t, err)
+	release := make(chan struct{})
+	available := uint64(0)
+	fetcher := testFetcher{func() ([]byte, error) {
+		<-release
+		if atomic.LoadUint64(&available) == 1 {
+			return []byte("123456"), nil
+		}
+		return nil, fmt.Errorf("source is not available")
+	}}
+	service := orchestrator.NewService(testConfig, testResizer{}, fetcher, nil, memoryCache, log)
+
+	request := resizeRequest(0, testConfig.MaxClientAsyncRequests+2)
+	resp, err := service.ProcessResizes(context.Background(), request, true)
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.JobID)
+
+	_, ok, err := service.GetJob(context.Background(), "unknown")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// client can't take more workers than its limit, so last images wait in queue
+	require.Eventually(t, func() bool {
+		job, ok, err := service.GetJob(context.Background(), resp.JobID)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, entities.ResizeResultStatusProcessing, job.Status)
+		require.Len(t, job.Images, len(request.URLs))
+		last := job.Images[len(job.Images)-1]
+		return last.QueuePosition == 2 && last.QueuedAt != nil && last.StartedAt == nil
+	}, 4*time.Second, 10*time.Millisecond)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		job, _, err := service.GetJob(context.Background(), resp.JobID)
+		require.NoError(t, err)
+		return job.Status == entities.ResizeResultStatusFailure
+	}, 4*time.Second, 10*time.Millisecond)
+	job, _, err := service.GetJob(context.Background(), resp.JobID)
+	require.NoError(t, err)
+	for _, image := range job.Images {
+		require.Equal(t, entities.ResizeResultStatusFailure, image.Result)
+		require.NotEmpty(t, image.Error)
+		require.Empty(t, image.URL)
+		require.Zero(t, image.QueuePosition)
+		require.NotNil(t, image.FinishedAt)
+		require.Equal(t, 1, image.Attempts)
+	}
+
+	// failed images are processed again by next request
+	atomic.StoreUint64(&available, 1)
+	retry, err := service.ProcessResizes(context.Background(), request, true)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		job, _, err := service.GetJob(context.Background(), retry.JobID)
+		require.NoError(t, err)
+		return job.Status == entities.ResizeResultStatusSuccess
+	}, 4*time.Second, 10*time.Millisecond)
+	require.NoError(t, service.Shutdown())
+}
+
+func TestService_JobKeepsFinishedStatus(t *testing.T) {
+	memoryCache, err := cache.NewCache(1024, "", log)
+	require.NoError(t, err)
+	release := make(chan struct{})
+	fetches := uint64(0)
+	fetcher := testFetcher{func() ([]byte, error) {
+		if atomic.AddUint64(&fetches, 1) > 1 {
+			<-release
+		}
+		return []byte("123456"), nil
+	}}
+	service := orchestrator.NewService(testConfig, testResizer{}, fetcher, nil, memoryCache, log)
+	jobStatus := func(jobID string) entities.ResizeResultStatus {
+		job, ok, err := service.GetJob(context.Background(), jobID)
+		require.NoError(t, err)
+		require.True(t, ok)
+		return job.Status
+	}
+
+	first, err := service.ProcessResizes(context.Background(), resizeRequest(1, 1), true)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return jobStatus(first.JobID) == entities.ResizeResultStatusSuccess
+	}, 4*time.Second, 10*time.Millisecond)
+
+	// image is processed again by later request, finished job is not changed by it
+	request := resizeRequest(1, 1)
+	request.Revalidate = true
+	second, err := service.ProcessResizes(context.Background(), request, true)
+	require.NoError(t, err)
+	require.Equal(t, entities.ResizeResultStatusProcessing, jobStatus(second.JobID))
+	require.Equal(t, entities.ResizeResultStatusSuccess, jobStatus(first.JobID))
+	events, ok, err := service.WatchJob(context.Background(), first.JobID)
+	require.NoError(t, err)
+	require.True(t, ok)
+	event := <-events
+	require.Equal(t, entities.ResizeResultStatusSuccess, event.Result)
+	_, open := <-events
+	require.False(t, open)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		return jobStatus(second.JobID) == entities.ResizeResultStatusSuccess
+	}, 4*time.Second, 10*time.Millisecond)
+	require.NoError(t, service.Shutdown())
+}
+
+func TestService_JobCallback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	notifier := webhook.NewMockNotifier(ctrl)
+	memoryCache, err := cache.NewCache(1024, "", log)
+	require.NoError(t, err)
+	fetcher := testFetcher{func() ([]byte, error) {
+		return []byte("123456"), nil
+	}}
+	service := orchestrator.NewService(testConfig, testResizer{}, fetcher, notifier, memoryCache, log)
+
+	notified := make(chan string)
+	notifier.EXPECT().CheckURL(gomock.Any(), "http://localhost:8081/callback").Return(nil)
+	notifier.EXPECT().Notify(gomock.Any(), "http://localhost:8081/callback", gomock.Any(), []entities.ResizeResult{{
+		Result:   entities.ResizeResultStatusSuccess,
+		URL:      baseURL + "/v1/image/" + sampleURLHash + ".jpg",
+		Attempts: 1,
+	}}).DoAndReturn(func(_ context.Context, _, jobID string, _ []entities.ResizeResult) error {
+		notified <- jobID
+		return nil
+	})
+	resp, err := service.ProcessResizes(context.Background(), &entities.ResizeRequest{
+		URLs:        []string{sampleURL},
+		Height:      1,
+		Width:       1,
+		CallbackURL: "http://localhost:8081/callback",
+	}, true)
+	require.NoError(t, err)
+
+	select {
+	case jobID := <-notified:
+		require.Equal(t, resp.JobID, jobID)
+	case <-time.After(4 * time.Second):
+		t.Fatal("callback is not sent")
+	}
+	require.NoError(t, service.Shutdown())
+}
+
+func TestService_CallbacksDisabled(t *testing.T) {
+	memoryCache, err := cache.NewCache(1024, "", log)
+	require.NoError(t, err)
+	fetcher := testFetcher{func() ([]byte, error) {
+		return []byte("123456"), nil
+	}}
+	service := orchestrator.NewService(testConfig, testResizer{}, fetcher, nil, memoryCache, log)
+	_, err = service.ProcessResizes(context.Background(), &entities.ResizeRequest{
+		URLs:        []string{sampleURL},
+		Height:      1,
+		Width:       1,
+		CallbackURL: "http://localhost:8081/callback",
+	}, true)
+	require.ErrorIs(t, err, orchestrator.ErrCallbacksDisabled)
+	require.NoError(t, service.Shutdown())
+}
+
+func TestService_WatchJob(t *testing.T) {
+	memoryCache, err := cache.NewCache(1024, "", log)
+	require.NoError(t, err)
+	release := make(chan struct{})
+	fetcher := testFetcher{func() ([]byte, error) {
+		<-release
+		return []byte("123456"), nil
+	}}
+	service := orchestrator.NewService(testConfig, testResizer{}, fetcher, nil, memoryCache, log)
+	resp, err := service.ProcessResizes(context.Background(), &entities.ResizeRequest{
+		URLs:   []string{sampleURL, "http://localhost:8080/2/abc"},
+		Height: 1,
+		Width:  1,
+	}, true)
+	require.NoError(t, err)
+
+	_, ok, err := service.WatchJob(context.Background(), "unknown")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	events, ok, err := service.WatchJob(context.Background(), resp.JobID)
+	require.NoError(t, err)
+	require.True(t, ok)
+	readEvent := func() entities.JobImageStatus {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(4 * time.Second):
+			t.Fatal("event is not sent")
+		}
+		return entities.JobImageStatus{}
+	}
+
+	// current status is sent first
+	for i := 0; i < 2; i++ {
+		event := readEvent()
+		require.Equal(t, entities.ResizeResultStatusProcessing, event.Result)
+		require.Empty(t, event.URL)
+	}
+
+	close(release)
+	finished := map[string]string{}
+	for i := 0; i < 2; i++ {
+		event := readEvent()
+		require.Equal(t, entities.ResizeResultStatusSuccess, event.Result)
+		require.NotNil(t, event.FinishedAt)
+		finished[event.SourceURL] = event.URL
+	}
+	require.Equal(t, map[string]string{
+		sampleURL:                     resp.Results[0].URL,
+		"http://localhost:8080/2/abc": resp.Results[1].URL,
+	}, finished)
+
+	_, open := <-events
+	require.False(t, open)
+	require.NoError(t, service.Shutdown())
+}
+
+func TestService_QueueFull(t *testing.T) {
+	started := uint64(0)
+	memoryCache, err := cache.NewCache(1024, "", log)
+	require.NoError(t, err)
+	service := orchestrator.NewService(testConfig, testResizer{}, blockingFetcher{started: &started}, nil, memoryCache, log)
+	// worker takes tasks as soon as they are added
+	occupyWorkers(t, service, &started)
+
+	// single client can't take whole queue
+	request := resizeRequest(0, testConfig.MaxClientQueueSize+1)
+	_, err = service.ProcessResizes(context.Background(), request, true)
+	require.ErrorIs(t, err, orchestrator.ErrClientQueueFull)
+
+	for from := 0; from < testConfig.MaxQueueSize; from += testConfig.MaxClientQueueSize {
+		request = resizeRequest(from, testConfig.MaxClientQueueSize)
+		request.ClientID = fmt.Sprintf("client%d", from)
+		_, err = service.ProcessResizes(context.Background(), request, true)
+		require.NoError(t, err)
+	}
+	_, err = service.ProcessResizes(context.Background(), resizeRequest(testConfig.MaxQueueSize, 1), true)
+	require.ErrorIs(t, err, orchestrator.ErrQueueFull)
+	// already queued images are not rejected
+	_, err = service.ProcessResizes(context.Background(), resizeRequest(0, 1), true)
+	require.NoError(t, err)
+
+	require.Equal(t, entities.QueueStats{
+		Depth:      testConfig.MaxQueueSize,
+		Capacity:   testConfig.MaxQueueSize,
+		Processing: testConfig.MaxAsyncRequests,
+		Rejected:   2,
+		Lanes: map[entities.Priority]int{
+			entities.PriorityHigh:   0,
+			entities.PriorityNormal: testConfig.MaxQueueSize,
+			entities.PriorityLow:    0,
+		},
+	}, service.QueueStats())
+	require.NoError(t, service.Shutdown())
+}
+
+func TestService_Priority(t *testing.T) {
+	started := uint64(0)
+	memoryCache, err := cache.NewCache(1024, "", log)
+	require.NoError(t, err)
+	service := orchestrator.NewService(testConfig, testResizer{}, blockingFetcher{started: &started}, nil, memoryCache, log)
+	request := func(from, count int, priority entities.Priority) *entities.ResizeRequest {
+		request := resizeRequest(from, count)
+		request.Priority = priority
+		return request
+	}
+
+	occupyWorkers(t, service, &started)
+
+	low, err := service.ProcessResizes(context.Background(), request(100, 3, entities.PriorityLow), true)
+	require.NoError(t, err)
+	normal, err := service.ProcessResizes(context.Background(), request(200, 3, entities.PriorityNormal), true)
+	require.NoError(t, err)
+	high, err := service.ProcessResizes(context.Background(), request(300, 12, entities.PriorityHigh), true)
+	require.NoError(t, err)
+
+	// of every 10 slots high lane gets 6, normal 3 and low 1, so low priority is not starved by later high priority tasks.
+	// Lanes are interleaved by smooth weighted round-robin instead of serving each lane in bursts.
+	require.Equal(t, []int{1, 3, 4, 6, 8, 10, 11, 12, 13, 14, 15, 17}, queuePositions(t, service, high.JobID))
+	require.Equal(t, []int{2, 5, 9}, queuePositions(t, service, normal.JobID))
+	require.Equal(t, []int{7, 16, 18}, queuePositions(t, service, low.JobID))
+	require.NoError(t, service.Shutdown())
+}
+
+func TestService_PriorityPromotion(t *testing.T) {
+	started := uint64(0)
+	memoryCache, err := cache.NewCache(1024, "", log)
+	require.NoError(t, err)
+	service := orchestrator.NewService(testConfig, testResizer{}, blockingFetcher{started: &started}, nil, memoryCache, log)
+	request := func(from, count int, priority entities.Priority) *entities.ResizeRequest {
+		request := resizeRequest(from, count)
+		request.Priority = priority
+		return request
+	}
+
+	occupyWorkers(t, service, &started)
+
+	low, err := service.ProcessResizes(context.Background(), request(100, 3, entities.PriorityLow), true)
+	require.NoError(t, err)
+	normal, err := service.ProcessResizes(context.Background(), request(200, 3, entities.PriorityNormal), true)
+	require.NoError(t, err)
+	// queued low priority image is moved to high lane, when it is requested with high priority
+	high, err := service.ProcessResizes(context.Background(), request(101, 1, entities.PriorityHigh), true)
+	require.NoError(t, err)
+	// lower priority request doesn't demote it
+	_, err = service.ProcessResizes(context.Background(), request(101, 1, entities.PriorityLow), true)
+	require.NoError(t, err)
+
+	require.Equal(t, []int{1}, queuePositions(t, service, high.JobID))
+	require.Equal(t, []int{5, 1, 6}, queuePositions(t, service, low.JobID))
+	require.Equal(t, []int{2, 3, 4}, queuePositions(t, service, normal.JobID))
+	require.Equal(t, map[entities.Priority]int{
+		entities.PriorityHigh:   1,
+		entities.PriorityNormal: 3,
+		entities.PriorityLow:    2,
+	}, service.QueueStats().Lanes)
+	require.Equal(t, 6, service.QueueStats().Depth)
+	require.NoError(t, service.Shutdown())
+}
+
+func TestService_ClientFairness(t *testing.T) {
+	t.Run("async", func(t *testing.T) {
+		started := uint64(0)
+		memoryCache, err := cache.NewCache(1024, "", log)
+		require.NoError(t, err)
+		service := orchestrator.NewService(testConfig, testResizer{}, blockingFetcher{started: &started}, nil, memoryCache, log)
+		occupyWorkers(t, service, &started)
+
+		// clients are served in round-robin order, so later small batch is not stuck behind big one
+		big := resizeRequest(0, 6)
+		big.ClientID = "big"
+		bigResp, err := service.ProcessResizes(context.Background(), big, true)
+		require.NoError(t, err)
+		small := resizeRequest(100, 3)
+		small.ClientID = "small"
+		smallResp, err := service.ProcessResizes(context.Background(), small, true)
+		require.NoError(t, err)
+
+		require.Equal(t, []int{1, 3, 5, 7, 8, 9}, queuePositions(t, service, bigResp.JobID))
+		require.Equal(t, []int{2, 4, 6}, queuePositions(t, service, smallResp.JobID))
+		require.NoError(t, service.Shutdown())
+	})
+	t.Run("sync", func(t *testing.T) {
+		var mu sync.Mutex
+		running := map[string]int{}
+		maxRunning := map[string]int{}
+		fetcher := fetch.NewMockFetcher(gomock.NewController(t))
+		fetcher.EXPECT().Fetch(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, url string, _ fetch.Validators) (fetch.Response, error) {
+			client := strings.Split(url, "/")[3]
+			mu.Lock()
+			running[client]++
+			if running[client] > maxRunning[client] {
+				maxRunning[client] = running[client]
+			}
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			running[client]--
+			mu.Unlock()
+			return fetch.Response{Data: []byte("123456"), Attempts: 1}, nil
+		}).AnyTimes()
+		memoryCache, err := cache.NewCache(1024*1024, "", log)
+		require.NoError(t, err)
+		service := orchestrator.NewService(testConfig, testResizer{}, fetcher, nil, memoryCache, log)
+
+		var wg sync.WaitGroup
+		for _, client := range []string{"a", "b"} {
+			request := &entities.ResizeRequest{Height: 1, Width: 1, ClientID: client}
+			for i := 0; i < 4*testConfig.MaxClientSyncRequests; i++ {
+				request.URLs = append(request.URLs, fmt.Sprintf("http://localhost:8080/%s/%d", client, i))
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := service.ProcessResizes(context.Background(), request, false)
+				require.NoError(t, err)
+				require.Len(t, resp.Results, len(request.URLs))
+			}()
+		}
+		wg.Wait()
+		require.Equal(t, map[string]int{"a": testConfig.MaxClientSyncRequests, "b": testConfig.MaxClientSyncRequests}, maxRunning)
+		require.NoError(t, service.Shutdown())
+	})
+}
+
+func TestService_Reload(t *testing.T) {
+	started := uint64(0)
+	memoryCache, err := cache.NewCache(1024, "", log)
+	require.NoError(t, err)
+	cfg := testConfig
+	cfg.MaxAsyncRequests, cfg.MaxClientAsyncRequests = 2, 2
+	service := orchestrator.NewService(cfg, testResizer{}, blockingFetcher{started: &started}, nil, memoryCache, log)
+	// idle worker waiting for task is not counted
+	require.Zero(t, service.QueueStats().Processing)
+
+	_, err = service.ProcessResizes(context.Background(), resizeRequest(0, 5), true)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return atomic.LoadUint64(&started) == 2
+	}, 4*time.Second, time.Millisecond)
+
+	// images in progress are kept, waiting ones are started up to new limits
+	cfg.MaxAsyncRequests, cfg.MaxClientAsyncRequests, cfg.MaxQueueSize = 4, 4, 10
+	service.Reload(cfg)
+	require.Eventually(t, func() bool {
+		return atomic.LoadUint64(&started) == 4
+	}, 4*time.Second, time.Millisecond)
+	stats := service.QueueStats()
+	require.Equal(t, 1, stats.Depth)
+	require.Equal(t, 10, stats.Capacity)
+	require.Equal(t, 4, stats.Processing)
+	require.NoError(t, service.Shutdown())
+}
+
+func TestService_Revalidate(t *testing.T) {
+	memoryCache, err := cache.NewCache(1024, "", log)
+	require.NoError(t, err)
+	fetcher := fetch.NewMockFetcher(gomock.NewController(t))
+	service := orchestrator.NewService(testConfig, testResizer{}, fetcher, nil, memoryCache, log)
+	ctx := context.Background()
+	v1 := fetch.Validators{ETag: `"v1"`}
+	v2 := fetch.Validators{ETag: `"v2"`}
+
+	process := func(revalidate bool) entities.ResizeResult {
+		request := resizeRequest(1, 1)
+		request.Revalidate = revalidate
+		resp, err := service.ProcessResizes(ctx, request, false)
+		require.NoError(t, err)
+		require.Len(t, resp.Results, 1)
+		require.Equal(t, entities.ResizeResultStatusSuccess, resp.Results[0].Result)
+		return resp.Results[0]
+	}
+	requireImage := func(data string) {
+		image, ok, err := service.GetImage(ctx, sampleURLHash)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, []byte(data), image)
+	}
+
+	gomock.InOrder(
+		fetcher.EXPECT().Fetch(gomock.Any(), sampleURL, fetch.Validators{}).
+			Return(fetch.Response{Data: []byte("first"), Attempts: 1, Validators: v1}, nil),
+		fetcher.EXPECT().Fetch(gomock.Any(), sampleURL, v1).
+			Return(fetch.Response{Attempts: 1, NotModified: true, Validators: v1, ExpiresAt: time.Now().Add(-time.Second)}, nil),
+		fetcher.EXPECT().Fetch(gomock.Any(), sampleURL, v1).
+			Return(fetch.Response{Data: []byte("second"), Attempts: 1, Validators: v2}, nil),
+		fetcher.EXPECT().Fetch(gomock.Any(), sampleURL, v2).
+			Return(fetch.Response{}, &fetch.Error{Class: fetch.ErrorClassNetwork, Attempts: 2, Err: fmt.Errorf("source is not available")}),
+	)
+
+	require.False(t, process(false).Cached)
+	// not expired image is served from cache without requests to source
+	require.True(t, process(false).Cached)
+	requireImage("first")
+
+	// not modified image is kept
+	result := process(true)
+	require.True(t, result.Cached)
+	require.Equal(t, 1, result.Attempts)
+	requireImage("first")
+
+	// expired image is revalidated without request, changed image is resized again
+	result = process(false)
+	require.False(t, result.Cached)
+	requireImage("second")
+
+	// cached image is served, if source is not available
+	result = process(true)
+	require.True(t, result.Cached)
+	require.Equal(t, 2, result.Attempts)
+	requireImage("second")
+	// metadata is stored in image cache, but it can't be requested as image
+	require.Equal(t, 2, memoryCache.Len())
+	_, ok, err := service.GetImage(ctx, sampleURLHash+"_meta")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.NoError(t, service.Shutdown())
+}
+
+func TestService_SourceCache(t *testing.T) {
+	memoryCache, err := cache.NewCache(1024, "", log)
+	require.NoError(t, err)
+	fetcher := fetch.NewMockFetcher(gomock.NewController(t))
+	cfg := testConfig
+	cfg.SourceCacheSize = 1024
+	cfg.SourceCacheTTL = time.Minute
+	service := orchestrator.NewService(cfg, testResizer{}, fetcher, nil, memoryCache, log)
+	ctx := context.Background()
+
+	// process resizes url to width and returns resized image
+	process := func(url string, width uint) []byte {
+		resp, err := service.ProcessResizes(ctx, &entities.ResizeRequest{URLs: []string{url}, Width: width, Height: 1}, false)
+		require.NoError(t, err)
+		require.Equal(t, entities.ResizeResultStatusSuccess, resp.Results[0].Result)
+		imageID := strings.TrimSuffix(path.Base(resp.Results[0].URL), ".jpg")
+		image, ok, err := service.GetImage(ctx, imageID)
+		require.NoError(t, err)
+		require.True(t, ok)
+		return image
+	}
+
+	t.Run("should download source once for all sizes", func(t *testing.T) {
+		fetcher.EXPECT().Fetch(gomock.Any(), "http://localhost:8080/source/1", fetch.Validators{}).
+			Return(fetch.Response{Data: []byte("first"), Attempts: 1}, nil)
+		for width := uint(1); width <= 3; width++ {
+			require.Equal(t, []byte("first"), process("http://localhost:8080/source/1", width))
+		}
+		stats := service.SourceCacheStats()
+		require.Equal(t, uint64(2), stats.Hits)
+		require.Equal(t, uint64(1), stats.Misses)
+		require.Equal(t, int64(len("first")), stats.Bytes)
+	})
+	t.Run("should not keep no-store source", func(t *testing.T) {
+		fetcher.EXPECT().Fetch(gomock.Any(), "http://localhost:8080/source/2", fetch.Validators{}).
+			Return(fetch.Response{Data: []byte("second"), Attempts: 1, NoStore: true}, nil).Times(2)
+		process("http://localhost:8080/source/2", 1)
+		process("http://localhost:8080/source/2", 2)
+	})
+	t.Run("should revalidate expired source", func(t *testing.T) {
+		validators := fetch.Validators{ETag: `"v1"`}
+		gomock.InOrder(
+			fetcher.EXPECT().Fetch(gomock.Any(), "http://localhost:8080/source/3", fetch.Validators{}).
+				Return(fetch.Response{Data: []byte("third"), Attempts: 1, Validators: validators, ExpiresAt: time.Now()}, nil),
+			fetcher.EXPECT().Fetch(gomock.Any(), "http://localhost:8080/source/3", validators).
+				Return(fetch.Response{Attempts: 1, NotModified: true, Validators: validators}, nil),
+		)
+		process("http://localhost:8080/source/3", 1)
+		require.Equal(t, []byte("third"), process("http://localhost:8080/source/3", 2))
+	})
+	t.Run("should revalidate fresh source when requested", func(t *testing.T) {
+		url := "http://localhost:8080/source/4"
+		gomock.InOrder(
+			fetcher.EXPECT().Fetch(gomock.Any(), url, fetch.Validators{}).
+				Return(fetch.Response{Data: []byte("fourth"), Attempts: 1, Validators: fetch.Validators{ETag: `"v1"`}}, nil),
+			fetcher.EXPECT().Fetch(gomock.Any(), url, fetch.Validators{ETag: `"v1"`}).
+				Return(fetch.Response{Data: []byte("changed"), Attempts: 1, Validators: fetch.Validators{ETag: `"v2"`}}, nil),
+		)
+		require.Equal(t, []byte("fourth"), process(url, 1))
+		resp, err := service.ProcessResizes(ctx, &entities.ResizeRequest{URLs: []string{url}, Width: 1, Height: 1, Revalidate: true}, false)
+		require.NoError(t, err)
+		require.Equal(t, entities.ResizeResultStatusSuccess, resp.Results[0].Result)
+		require.False(t, resp.Results[0].Cached)
+		require.Equal(t, []byte("changed"), process(url, 1))
+	})
+	t.Run("should count changed source as miss", func(t *testing.T) {
+		url := "http://localhost:8080/source/5"
+		validators := fetch.Validators{ETag: `"v1"`}
+		gomock.InOrder(
+			fetcher.EXPECT().Fetch(gomock.Any(), url, fetch.Validators{}).
+				Return(fetch.Response{Data: []byte("fifth"), Attempts: 1, Validators: validators, ExpiresAt: time.Now()}, nil),
+			fetcher.EXPECT().Fetch(gomock.Any(), url, validators).
+				Return(fetch.Response{Data: []byte("changed"), Attempts: 1, Validators: fetch.Validators{ETag: `"v2"`}}, nil),
+		)
+		before := service.SourceCacheStats()
+		process(url, 1)
+		require.Equal(t, []byte("changed"), process(url, 2))
+		after := service.SourceCacheStats()
+		require.Equal(t, before.Hits, after.Hits)
+		require.Equal(t, before.Misses+2, after.Misses)
+	})
+	t.Run("should be disabled by reload", func(t *testing.T) {
+		cfg.SourceCacheSize = 0
+		service.Reload(cfg)
+		require.Zero(t, service.SourceCacheStats().Items)
+		before := service.SourceCacheStats()
+		fetcher.EXPECT().Fetch(gomock.Any(), "http://localhost:8080/source/1", fetch.Validators{}).
+			Return(fetch.Response{Data: []byte("first"), Attempts: 1}, nil)
+		process("http://localhost:8080/source/1", 4)
+		require.Equal(t, before, service.SourceCacheStats())
+	})
+	require.NoError(t, service.Shutdown())
+}
+
+func TestService_Coalescing(t *testing.T) {
+	memoryCache, err := cache.NewCache(1024, "", log)
+	require.NoError(t, err)
+	release := make(chan struct{})
+	fetches := uint64(0)
+	fetcher := fetch.NewMockFetcher(gomock.NewController(t))
+	fetcher.EXPECT().Fetch(gomock.Any(), sampleURL, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, _ string, _ fetch.Validators) (fetch.Response, error) {
+			atomic.AddUint64(&fetches, 1)
+			select {
+			case <-release:
+				return fetch.Response{Data: []byte("123456"), Attempts: 1}, nil
+			case <-ctx.Done():
+				return fetch.Response{}, ctx.Err()
+			}
+		}).Times(2)
+	service := orchestrator.NewService(testConfig, testResizer{}, fetcher, nil, memoryCache, log)
+	ctx := context.Background()
+	const requests = 8
+
+	// processing is started by request, which is canceled later
+	canceledCtx, cancel := context.WithCancel(ctx)
+	canceled := make(chan entities.ResizeResult, 1)
+	go func() {
+		resp, err := service.ProcessResizes(canceledCtx, resizeRequest(1, 1), false)
+		require.NoError(t, err)
+		canceled <- resp.Results[0]
+	}()
+	require.Eventually(t, func() bool {
+		return atomic.LoadUint64(&fetches) == 1
+	}, 4*time.Second, time.Millisecond)
+
+	var wg sync.WaitGroup
+	results := make(chan entities.ResizeResult, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			request := resizeRequest(1, 1)
+			request.ClientID = fmt.Sprintf("client%d", i)
+			resp, err := service.ProcessResizes(ctx, request, false)
+			require.NoError(t, err)
+			results <- resp.Results[0]
+		}(i)
+	}
+	// async task joins processing of sync requests too
+	job, err := service.ProcessResizes(ctx, resizeRequest(1, 1), true)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return service.QueueStats().Waiting == requests+1
+	}, 4*time.Second, time.Millisecond)
+
+	// canceled request doesn't fail other requests, one of them starts processing again
+	cancel()
+	require.Equal(t, entities.ResizeResultStatusFailure, (<-canceled).Result)
+	require.Eventually(t, func() bool {
+		return atomic.LoadUint64(&fetches) == 2 && service.QueueStats().Waiting == requests
+	}, 4*time.Second, time.Millisecond)
+
+	close(release)
+	wg.Wait()
+	close(results)
+	for result := range results {
+		require.Equal(t, entities.ResizeResultStatusSuccess, result.Result)
+		require.Equal(t, 1, result.Attempts)
+	}
+	require.Eventually(t, func() bool {
+		status, _, err := service.GetJob(ctx, job.JobID)
+		require.NoError(t, err)
+		return status.Status == entities.ResizeResultStatusSuccess
+	}, 4*time.Second, 10*time.Millisecond)
+	// all requests except one, which processed image, are coalesced
+	require.Equal(t, uint64(requests), service.QueueStats().Coalesced)
+	require.NoError(t, service.Shutdown())
+}
@@ -0,0 +1,205 @@
+package orchestrator
+
+import (
+	"container/list"
+	"context"
+	"interview-fm-backend/internal/entities"
+	"interview-fm-backend/internal/service/fetch"
+	"sync"
+	"time"
+)
+
+// sourceEntry is downloaded source image with its caching headers.
+type sourceEntry struct {
+	url        string
+	data       []byte
+	validators fetch.Validators
+	expiresAt  time.Time // expiry by `max-age` of source, zero if not limited
+	freshUntil time.Time // entry is used without requests to source until this time
+}
+
+// response returns entry as response to request with validators of resized image.
+// If resized image is made from the same version of source, it is reported as not modified.
+func (e *sourceEntry) response(validators fetch.Validators) fetch.Response {
+	resp := fetch.Response{Validators: e.validators, ExpiresAt: e.expiresAt}
+	if validators != (fetch.Validators{}) && validators == e.validators {
+		resp.NotModified = true
+		return resp
+	}
+	resp.Data = e.data
+	return resp
+}
+
+// sourceCache keeps downloaded source images by url, so several sizes of the same image are made from single download.
+// It is bounded by total size of images, least recently used ones are evicted. Images are fresh for `max-age`
+// of their `Cache-Control` header or for ttl, if header has no limit. `no-store` images are not kept.
+// Stale images with validators are kept, so they are revalidated by conditional request instead of downloading.
+type sourceCache struct {
+	mu        sync.Mutex
+	maxBytes  int64 // 0 disables cache
+	ttl       time.Duration
+	size      int64
+	order     *list.List // most recently used entries are in front
+	items     map[string]*list.Element
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+func newSourceCache(maxBytes int64, ttl time.Duration) *sourceCache {
+	return &sourceCache{maxBytes: maxBytes, ttl: ttl, order: list.New(), items: map[string]*list.Element{}}
+}
+
+// enabled reports if cache has non zero size limit.
+func (c *sourceCache) enabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.maxBytes > 0
+}
+
+// get returns entry of url, which can be stale. Lookup is counted by caller, when it is known if entry is used.
+func (c *sourceCache) get(url string) (*sourceEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[url]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return entry(el), true
+}
+
+// count reports lookup as hit, if cached image was used without download, or as miss otherwise.
+func (c *sourceCache) count(hit bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if hit {
+		c.hits++
+	} else {
+		c.misses++
+	}
+}
+
+// add stores downloaded image. If response is not modified, data of stale entry is refreshed by it.
+func (c *sourceCache) add(url string, data []byte, resp fetch.Response, now time.Time) {
+	if resp.NoStore {
+		c.remove(url)
+		return
+	}
+	freshUntil := resp.ExpiresAt
+	if freshUntil.IsZero() {
+		freshUntil = now.Add(c.ttl)
+	}
+	if !freshUntil.After(now) && resp.Validators == (fetch.Validators{}) {
+		// image can't be used without download
+		c.remove(url)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	size := int64(len(data))
+	if size > c.maxBytes {
+		return
+	}
+	e := &sourceEntry{url: url, data: data, validators: resp.Validators, expiresAt: resp.ExpiresAt, freshUntil: freshUntil}
+	if el, ok := c.items[url]; ok {
+		c.size += size - int64(len(entry(el).data))
+		el.Value = e
+		c.order.MoveToFront(el)
+	} else {
+		c.items[url] = c.order.PushFront(e)
+		c.size += size
+	}
+	c.evict()
+}
+
+func (c *sourceCache) remove(url string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[url]; ok {
+		c.removeElement(el)
+	}
+}
+
+// setLimits changes size limit and ttl of cache, 0 size clears and disables cache.
+func (c *sourceCache) setLimits(maxBytes int64, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxBytes = maxBytes
+	c.ttl = ttl
+	c.evict()
+}
+
+// evict removes least recently used entries until cache fits into size limit. Should be called under lock.
+func (c *sourceCache) evict() {
+	for c.size > c.maxBytes {
+		c.removeElement(c.order.Back())
+		c.evictions++
+	}
+}
+
+func (c *sourceCache) removeElement(el *list.Element) {
+	e := entry(el)
+	c.order.Remove(el)
+	delete(c.items, e.url)
+	c.size -= int64(len(e.data))
+}
+
+func entry(el *list.Element) *sourceEntry {
+	e, _ := el.Value.(*sourceEntry)
+	return e
+}
+
+func (c *sourceCache) stats() entities.CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return entities.CacheStats{
+		Items:     c.order.Len(),
+		Bytes:     c.size,
+		MaxBytes:  c.maxBytes,
+		Evictions: c.evictions,
+		Hits:      c.hits,
+		Misses:    c.misses,
+	}
+}
+
+// fetchSource returns source image from source cache or downloads it. Fresh cached image is used without requests,
+// unless source should be revalidated, stale one is revalidated by its validators. Validators of resized image are
+// checked against cached image, so resized image is reported as not modified, if it is made from the same version of source.
+func (s *Service) fetchSource(ctx context.Context, url string, validators fetch.Validators, revalidate bool) (fetch.Response, error) {
+	if !s.sources.enabled() {
+		return s.fetcherService.Fetch(ctx, url, validators)
+	}
+	cached, ok := s.sources.get(url)
+	if ok && !revalidate && time.Now().Before(cached.freshUntil) {
+		s.sources.count(true)
+		return cached.response(validators), nil
+	}
+	revalidateCached := ok && cached.validators != (fetch.Validators{})
+	request := validators
+	if revalidateCached {
+		request = cached.validators
+	}
+	resp, err := s.fetcherService.Fetch(ctx, url, request)
+	// cached image is used only if source is not modified since it
+	s.sources.count(err == nil && resp.NotModified && revalidateCached)
+	if err != nil {
+		return resp, err
+	}
+	if !resp.NotModified {
+		s.sources.add(url, resp.Data, resp, time.Now())
+		return resp, nil
+	}
+	if !revalidateCached {
+		// resized image is not modified, source is not cached
+		return resp, nil
+	}
+	s.sources.add(url, cached.data, resp, time.Now())
+	refreshed := cached.response(validators)
+	refreshed.Attempts = resp.Attempts
+	refreshed.ExpiresAt = resp.ExpiresAt
+	if resp.Validators != (fetch.Validators{}) {
+		refreshed.Validators = resp.Validators
+	}
+	return refreshed, nil
+}
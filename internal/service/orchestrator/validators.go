@@ -0,0 +1,75 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"interview-fm-backend/internal/entities"
+	"interview-fm-backend/internal/logger"
+	"interview-fm-backend/internal/service/fetch"
+	"time"
+)
+
+// metadataSuffix is added to image key to store image metadata in the same cache, so metadata is shared by replicas
+// and survives restarts with images. Image urls can't address metadata, GetImage rejects keys with this suffix.
+const metadataSuffix = "_meta"
+
+// imageMetadata is stored in image cache alongside resized image. Validators of source are used to revalidate image,
+// format is used to build image url without reading image itself.
+type imageMetadata struct {
+	ETag         string               `json:"etag,omitempty"`
+	LastModified string               `json:"last_modified,omitempty"`
+	ExpiresAt    time.Time            `json:"expires_at,omitempty"` // zero means image is not revalidated until requested
+	Format       entities.ImageFormat `json:"format,omitempty"`
+}
+
+func metadataKey(imageID string) string {
+	return imageID + metadataSuffix
+}
+
+func metadataOf(resp fetch.Response, format entities.ImageFormat) imageMetadata {
+	return imageMetadata{
+		ETag:         resp.Validators.ETag,
+		LastModified: resp.Validators.LastModified,
+		ExpiresAt:    resp.ExpiresAt,
+		Format:       format,
+	}
+}
+
+func (m imageMetadata) expired(now time.Time) bool {
+	return !m.ExpiresAt.IsZero() && !now.Before(m.ExpiresAt)
+}
+
+func (m imageMetadata) fetchValidators() fetch.Validators {
+	return fetch.Validators{ETag: m.ETag, LastModified: m.LastModified}
+}
+
+// loadMetadata returns metadata of cached image. If ok is false, metadata is lost or not readable,
+// so image should be processed again, as it is unknown when its source should be revalidated.
+func (s *Service) loadMetadata(ctx context.Context, log logger.AppLogger, imageID string) (imageMetadata, bool) {
+	data, ok, err := s.cache.Get(ctx, metadataKey(imageID))
+	if err != nil {
+		log.Error("failed to get image metadata", err)
+		return imageMetadata{}, false
+	}
+	var m imageMetadata
+	if !ok {
+		return m, false
+	}
+	if err = json.Unmarshal(data, &m); err != nil {
+		log.Error("failed to parse image metadata", err)
+		return imageMetadata{}, false
+	}
+	return m, true
+}
+
+// storeMetadata saves metadata of image, replacing metadata of its previous version.
+func (s *Service) storeMetadata(ctx context.Context, log logger.AppLogger, imageID string, m imageMetadata) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		log.Error("failed to marshal image metadata", err)
+		return
+	}
+	if err = s.cache.Add(ctx, metadataKey(imageID), data); err != nil {
+		log.Error("failed to save image metadata", err)
+	}
+}
@@ -1,5 +1,7 @@
 package resize
 
+import "interview-fm-backend/internal/entities"
+
 type Resizer interface {
-	ResizeImage(data []byte, width uint, height uint) ([]byte, error)
+	ResizeImage(data []byte, params entities.ResizeParams) ([]byte, entities.ImageFormat, error)
 }
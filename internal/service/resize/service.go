@@ -1,6 +1,9 @@
 package resize
 
-import "interview-fm-backend/internal/utils"
+import (
+	"interview-fm-backend/internal/entities"
+	"interview-fm-backend/internal/utils"
+)
 
 type Service struct {
 }
@@ -9,6 +12,6 @@ func NewResizerService() *Service {
 	return &Service{}
 }
 
-func (s *Service) ResizeImage(data []byte, width uint, height uint) ([]byte, error) {
-	return utils.ResizeImage(data, width, height)
+func (s *Service) ResizeImage(data []byte, params entities.ResizeParams) ([]byte, entities.ImageFormat, error) {
+	return utils.ResizeImage(data, params)
 }
@@ -0,0 +1,14 @@
+package webhook
+
+import (
+	"context"
+	"interview-fm-backend/internal/entities"
+)
+
+//go:generate mockgen -source=abstract.go -destination=abstract_webhook_mock.go -package=webhook
+type Notifier interface {
+	// Notify delivers results of async job to callback url. Undelivered callbacks are stored to dead-letter log.
+	Notify(ctx context.Context, callbackURL, jobID string, results []entities.ResizeResult) error
+	// CheckURL rejects callback urls, which point to internal networks, by ErrCallbackNotAllowed.
+	CheckURL(ctx context.Context, callbackURL string) error
+}
@@ -0,0 +1,64 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: abstract.go
+
+// Package webhook is a generated GoMock package.
+package webhook
+
+import (
+	context "context"
+	entities "interview-fm-backend/internal/entities"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockNotifier is a mock of Notifier interface.
+type MockNotifier struct {
+	ctrl     *gomock.Controller
+	recorder *MockNotifierMockRecorder
+}
+
+// MockNotifierMockRecorder is the mock recorder for MockNotifier.
+type MockNotifierMockRecorder struct {
+	mock *MockNotifier
+}
+
+// NewMockNotifier creates a new mock instance.
+func NewMockNotifier(ctrl *gomock.Controller) *MockNotifier {
+	mock := &MockNotifier{ctrl: ctrl}
+	mock.recorder = &MockNotifierMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockNotifier) EXPECT() *MockNotifierMockRecorder {
+	return m.recorder
+}
+
+// CheckURL mocks base method.
+func (m *MockNotifier) CheckURL(ctx context.Context, callbackURL string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckURL", ctx, callbackURL)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CheckURL indicates an expected call of CheckURL.
+func (mr *MockNotifierMockRecorder) CheckURL(ctx, callbackURL interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckURL", reflect.TypeOf((*MockNotifier)(nil).CheckURL), ctx, callbackURL)
+}
+
+// Notify mocks base method.
+func (m *MockNotifier) Notify(ctx context.Context, callbackURL, jobID string, results []entities.ResizeResult) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Notify", ctx, callbackURL, jobID, results)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Notify indicates an expected call of Notify.
+func (mr *MockNotifierMockRecorder) Notify(ctx, callbackURL, jobID, results interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Notify", reflect.TypeOf((*MockNotifier)(nil).Notify), ctx, callbackURL, jobID, results)
+}
@@ -0,0 +1,263 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"interview-fm-backend/internal/entities"
+	"interview-fm-backend/internal/logger"
+	"interview-fm-backend/internal/utils"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	HeaderJobID     = "X-Webhook-Job-Id"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature" // `sha256=` followed by hex encoded HMAC-SHA256 of `timestamp.body`
+)
+
+type Config struct {
+	Secret         string        // key of signature, required
+	MaxAttempts    int           // total attempts of delivery, including first one
+	InitialBackoff time.Duration // delay before second attempt, doubled for each next attempt
+	MaxBackoff     time.Duration
+	Timeout        time.Duration // timeout of single attempt
+	DeadLetterPath string        // file to append undelivered callbacks, empty means they are only logged
+	// AllowedNetworks are exceptions from blocked loopback, private, link-local and other special networks,
+	// like internal receivers of callbacks.
+	AllowedNetworks []netip.Prefix
+}
+
+// deadLetter is record of undelivered callback, stored as single json line.
+type deadLetter struct {
+	JobID       string                  `json:"job_id"`
+	CallbackURL string                  `json:"callback_url"`
+	Results     []entities.ResizeResult `json:"results"`
+	Attempts    int                     `json:"attempts"`
+	Error       string                  `json:"error"`
+	FailedAt    time.Time               `json:"failed_at"`
+}
+
+// errPermanent marks responses, which will not be fixed by retry.
+var errPermanent = errors.New("permanent failure")
+
+// ErrCallbackNotAllowed is returned for callback urls, which are not http or point to internal networks.
+var ErrCallbackNotAllowed = errors.New("callback url is not allowed")
+
+// maxRedirects is how many redirects of callback receiver are followed.
+const maxRedirects = 10
+
+type Service struct {
+	cfg    Config
+	client *http.Client
+	log    logger.AppLogger
+
+	deadLetterMU sync.Mutex
+}
+
+func NewService(cfg Config, log logger.AppLogger) (*Service, error) {
+	if cfg.Secret == "" {
+		return nil, errors.New("webhook secret is not set")
+	}
+	if cfg.MaxAttempts < 1 {
+		return nil, fmt.Errorf("invalid webhook attempts: %d", cfg.MaxAttempts)
+	}
+	if cfg.InitialBackoff <= 0 || cfg.MaxBackoff < cfg.InitialBackoff {
+		return nil, fmt.Errorf("invalid webhook backoff: %s-%s", cfg.InitialBackoff, cfg.MaxBackoff)
+	}
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: utils.GuardedControl(func() []netip.Prefix {
+			return cfg.AllowedNetworks
+		}),
+	}
+	return &Service{
+		cfg: cfg,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:               nil, // proxy would hide real destination from address check
+				DialContext:         dialer.DialContext,
+				ForceAttemptHTTP2:   true,
+				MaxIdleConns:        100,
+				IdleConnTimeout:     90 * time.Second,
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+			CheckRedirect: checkRedirect,
+			Timeout:       cfg.Timeout,
+		},
+		log: log.With(zap.String("service", "webhook")),
+	}, nil
+}
+
+// CheckURL checks that callback url is http url of host, which doesn't resolve to blocked network.
+// Addresses are checked again on delivery, as DNS answer can be changed.
+func (s *Service) CheckURL(ctx context.Context, callbackURL string) error {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrCallbackNotAllowed, callbackURL)
+	}
+	if err = checkScheme(u); err != nil {
+		return err
+	}
+	if err = utils.CheckHost(ctx, u.Hostname(), s.cfg.AllowedNetworks); err != nil {
+		return fmt.Errorf("%w: %s", ErrCallbackNotAllowed, u.Hostname())
+	}
+	return nil
+}
+
+// checkRedirect limits redirects of receiver, target address is checked by dialer.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > maxRedirects {
+		return errors.New("too many redirects")
+	}
+	return checkScheme(req.URL)
+}
+
+func checkScheme(u *url.URL) error {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("%w: %s", ErrCallbackNotAllowed, u.Redacted())
+	}
+	return nil
+}
+
+// Notify posts results to callback url. Network errors, 408, 429 and 5xx responses are retried with exponential backoff,
+// other non-2xx responses fail delivery immediately. Delivery is stopped when context is done.
+func (s *Service) Notify(ctx context.Context, callbackURL, jobID string, results []entities.ResizeResult) error {
+	log := s.log.With(zap.String("jobID", jobID)).With(zap.String("callbackURL", callbackURL))
+	body, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("failed to marshal callback: %w", err)
+	}
+
+	attempt := 0
+	err = s.retry(ctx, func() error {
+		attempt++
+		sendErr := s.send(ctx, callbackURL, jobID, body)
+		if sendErr != nil {
+			log.Info("callback attempt failed", zap.Int("attempt", attempt), zap.Error(sendErr))
+		}
+		return sendErr
+	})
+	if err == nil {
+		log.Info("callback delivered", zap.Int("attempts", attempt))
+		return nil
+	}
+
+	err = fmt.Errorf("failed to deliver callback after %d attempts: %w", attempt, err)
+	log.Error("callback is not delivered", err)
+	if dlErr := s.storeDeadLetter(deadLetter{
+		JobID:       jobID,
+		CallbackURL: callbackURL,
+		Results:     results,
+		Attempts:    attempt,
+		Error:       err.Error(),
+		FailedAt:    time.Now(),
+	}); dlErr != nil {
+		log.Error("failed to store dead letter", dlErr)
+	}
+	return err
+}
+
+// retry calls fn until it succeeds, returns permanent error, attempts are exhausted or context is done.
+// Delays between attempts have jitter, so callbacks failed at the same time are not retried at the same time.
+func (s *Service) retry(ctx context.Context, fn func() error) error {
+	backoff := utils.NewBackoff(s.cfg.InitialBackoff, s.cfg.MaxBackoff)
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := fn()
+		if err == nil || errors.Is(err, errPermanent) || attempt >= s.cfg.MaxAttempts {
+			return err
+		}
+		timer := time.NewTimer(backoff.Next())
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w, last error: %s", ctx.Err(), err)
+		}
+	}
+}
+
+func (s *Service) send(ctx context.Context, callbackURL, jobID string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create callback request: %w: %s", errPermanent, err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderJobID, jobID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(s.cfg.Secret, timestamp, body))
+	resp, err := s.client.Do(req)
+	if errors.Is(err, utils.ErrAddressNotAllowed) || errors.Is(err, ErrCallbackNotAllowed) {
+		return fmt.Errorf("callback request failed: %w: %s", errPermanent, err)
+	}
+	if err != nil {
+		return fmt.Errorf("callback request failed: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return fmt.Errorf("unexpected callback status: %d", resp.StatusCode)
+	}
+	return fmt.Errorf("%w: unexpected callback status: %d", errPermanent, resp.StatusCode)
+}
+
+func (s *Service) storeDeadLetter(letter deadLetter) error {
+	if s.cfg.DeadLetterPath == "" {
+		return nil
+	}
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+	s.deadLetterMU.Lock()
+	defer s.deadLetterMU.Unlock()
+	f, err := os.OpenFile(s.cfg.DeadLetterPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open dead letter log: %w", err)
+	}
+	_, err = f.Write(append(data, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Sign returns value of signature header. Receivers should compute it from timestamp header and raw body
+// and compare with received one using constant time comparison.
+func Sign(secret, timestamp string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	_, _ = h.Write([]byte(timestamp + "."))
+	_, _ = h.Write(body)
+	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Shutdown closes idle connections to callback receivers.
+func (s *Service) Shutdown() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
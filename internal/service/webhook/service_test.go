@@ -0,0 +1,179 @@
+package webhook_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"interview-fm-backend/internal/entities"
+	"interview-fm-backend/internal/logger"
+	"interview-fm-backend/internal/service/webhook"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var log, _ = logger.NewAppLogger()
+
+var testResults = []entities.ResizeResult{{
+	Result: entities.ResizeResultStatusSuccess,
+	URL:    "http://localhost:8080/v1/image/abc.jpg",
+}}
+
+func testConfig(deadLetter string) webhook.Config {
+	return webhook.Config{
+		Secret:         "secret",
+		MaxAttempts:    3,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     20 * time.Millisecond,
+		Timeout:        time.Second,
+		DeadLetterPath: deadLetter,
+		// test receivers are listening on loopback
+		AllowedNetworks: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+	}
+}
+
+// callbackServer responds with given statuses in order, last status is repeated.
+func callbackServer(t *testing.T, attempts *int32, statuses ...int) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempt := int(atomic.AddInt32(attempts, 1))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, "job1", r.Header.Get(webhook.HeaderJobID))
+		require.Equal(t, webhook.Sign("secret", r.Header.Get(webhook.HeaderTimestamp), body), r.Header.Get(webhook.HeaderSignature))
+		var results []entities.ResizeResult
+		require.NoError(t, json.Unmarshal(body, &results))
+		require.Equal(t, testResults, results)
+		if attempt > len(statuses) {
+			attempt = len(statuses)
+		}
+		w.WriteHeader(statuses[attempt-1])
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func readDeadLetters(t *testing.T, path string) []map[string]any {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err)
+	defer f.Close()
+	var letters []map[string]any
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		letter := map[string]any{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &letter))
+		letters = append(letters, letter)
+	}
+	return letters
+}
+
+func TestNewService(t *testing.T) {
+	cfg := testConfig("")
+	cfg.Secret = ""
+	_, err := webhook.NewService(cfg, log)
+	require.ErrorContains(t, err, "webhook secret is not set")
+}
+
+func TestService_Notify(t *testing.T) {
+	ctx := context.Background()
+	t.Run("retries transient failures", func(t *testing.T) {
+		deadLetter := filepath.Join(t.TempDir(), "webhook.deadletter")
+		attempts := int32(0)
+		srv := callbackServer(t, &attempts, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK)
+		notifier, err := webhook.NewService(testConfig(deadLetter), log)
+		require.NoError(t, err)
+
+		require.NoError(t, notifier.Notify(ctx, srv.URL, "job1", testResults))
+		require.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+		require.Empty(t, readDeadLetters(t, deadLetter))
+	})
+	t.Run("attempts exhausted", func(t *testing.T) {
+		deadLetter := filepath.Join(t.TempDir(), "webhook.deadletter")
+		attempts := int32(0)
+		srv := callbackServer(t, &attempts, http.StatusInternalServerError)
+		notifier, err := webhook.NewService(testConfig(deadLetter), log)
+		require.NoError(t, err)
+
+		require.Error(t, notifier.Notify(ctx, srv.URL, "job1", testResults))
+		require.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+		letters := readDeadLetters(t, deadLetter)
+		require.Len(t, letters, 1)
+		require.Equal(t, "job1", letters[0]["job_id"])
+		require.Equal(t, srv.URL, letters[0]["callback_url"])
+		require.Equal(t, float64(3), letters[0]["attempts"])
+	})
+	t.Run("permanent failure is not retried", func(t *testing.T) {
+		deadLetter := filepath.Join(t.TempDir(), "webhook.deadletter")
+		attempts := int32(0)
+		srv := callbackServer(t, &attempts, http.StatusBadRequest)
+		notifier, err := webhook.NewService(testConfig(deadLetter), log)
+		require.NoError(t, err)
+
+		require.Error(t, notifier.Notify(ctx, srv.URL, "job1", testResults))
+		require.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+		require.Len(t, readDeadLetters(t, deadLetter), 1)
+	})
+	t.Run("canceled context", func(t *testing.T) {
+		deadLetter := filepath.Join(t.TempDir(), "webhook.deadletter")
+		attempts := int32(0)
+		srv := callbackServer(t, &attempts, http.StatusOK)
+		notifier, err := webhook.NewService(testConfig(deadLetter), log)
+		require.NoError(t, err)
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		require.ErrorIs(t, notifier.Notify(canceled, srv.URL, "job1", testResults), context.Canceled)
+		require.Zero(t, atomic.LoadInt32(&attempts))
+		letters := readDeadLetters(t, deadLetter)
+		require.Len(t, letters, 1)
+		require.Equal(t, float64(0), letters[0]["attempts"])
+	})
+	t.Run("internal receiver is not allowed", func(t *testing.T) {
+		deadLetter := filepath.Join(t.TempDir(), "webhook.deadletter")
+		attempts := int32(0)
+		srv := callbackServer(t, &attempts, http.StatusOK)
+		cfg := testConfig(deadLetter)
+		cfg.AllowedNetworks = nil
+		notifier, err := webhook.NewService(cfg, log)
+		require.NoError(t, err)
+
+		require.Error(t, notifier.Notify(ctx, srv.URL, "job1", testResults))
+		require.Zero(t, atomic.LoadInt32(&attempts))
+		letters := readDeadLetters(t, deadLetter)
+		require.Len(t, letters, 1)
+		require.Equal(t, float64(1), letters[0]["attempts"])
+	})
+}
+
+func TestService_CheckURL(t *testing.T) {
+	ctx := context.Background()
+	notifier, err := webhook.NewService(testConfig(""), log)
+	require.NoError(t, err)
+	require.NoError(t, notifier.CheckURL(ctx, "http://127.0.0.1:8081/callback"))
+	require.ErrorIs(t, notifier.CheckURL(ctx, "ftp://127.0.0.1/callback"), webhook.ErrCallbackNotAllowed)
+
+	cfg := testConfig("")
+	cfg.AllowedNetworks = nil
+	notifier, err = webhook.NewService(cfg, log)
+	require.NoError(t, err)
+	for _, callbackURL := range []string{
+		"http://127.0.0.1:8081/callback",
+		"http://localhost/callback",
+		"http://10.0.0.1/callback",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/callback",
+		"http://[::ffff:127.0.0.1]/callback",
+	} {
+		require.ErrorIs(t, notifier.CheckURL(ctx, callbackURL), webhook.ErrCallbackNotAllowed, callbackURL)
+	}
+}
@@ -1,9 +1,26 @@
 package cache
 
+import (
+	"context"
+	"interview-fm-backend/internal/entities"
+)
+
 //go:generate mockgen -source=abstract.go -destination=abstract_cache_mock.go -package=cache
 type Cacher interface {
-	Get(key string) (value []byte, ok bool)
-	Contains(key string) bool
-	Add(key string, value []byte) (evicted bool)
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Contains(ctx context.Context, key string) (bool, error)
+	Add(ctx context.Context, key string, value []byte) error
 	Shutdown() error
 }
+
+// StatsProvider is implemented by caches, which can report their usage.
+type StatsProvider interface {
+	Stats() entities.CacheStats
+}
+
+// DirectURLProvider is implemented by storages, which can serve images to clients without this service.
+type DirectURLProvider interface {
+	// DirectURL returns url of stored item. If ok is false, item should be served by this service.
+	// Url doesn't wait for item, so it should be given to clients only when item is stored.
+	DirectURL(key string) (url string, ok bool)
+}
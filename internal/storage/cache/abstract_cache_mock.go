@@ -5,6 +5,8 @@
 package cache
 
 import (
+	context "context"
+	entities "interview-fm-backend/internal/entities"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -34,46 +36,48 @@ func (m *MockCacher) EXPECT() *MockCacherMockRecorder {
 }
 
 // Add mocks base method.
-func (m *MockCacher) Add(key string, value []byte) bool {
+func (m *MockCacher) Add(ctx context.Context, key string, value []byte) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Add", key, value)
-	ret0, _ := ret[0].(bool)
+	ret := m.ctrl.Call(m, "Add", ctx, key, value)
+	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Add indicates an expected call of Add.
-func (mr *MockCacherMockRecorder) Add(key, value interface{}) *gomock.Call {
+func (mr *MockCacherMockRecorder) Add(ctx, key, value interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockCacher)(nil).Add), key, value)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockCacher)(nil).Add), ctx, key, value)
 }
 
 // Contains mocks base method.
-func (m *MockCacher) Contains(key string) bool {
+func (m *MockCacher) Contains(ctx context.Context, key string) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Contains", key)
+	ret := m.ctrl.Call(m, "Contains", ctx, key)
 	ret0, _ := ret[0].(bool)
-	return ret0
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Contains indicates an expected call of Contains.
-func (mr *MockCacherMockRecorder) Contains(key interface{}) *gomock.Call {
+func (mr *MockCacherMockRecorder) Contains(ctx, key interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Contains", reflect.TypeOf((*MockCacher)(nil).Contains), key)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Contains", reflect.TypeOf((*MockCacher)(nil).Contains), ctx, key)
 }
 
 // Get mocks base method.
-func (m *MockCacher) Get(key string) ([]byte, bool) {
+func (m *MockCacher) Get(ctx context.Context, key string) ([]byte, bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Get", key)
+	ret := m.ctrl.Call(m, "Get", ctx, key)
 	ret0, _ := ret[0].([]byte)
 	ret1, _ := ret[1].(bool)
-	return ret0, ret1
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
 // Get indicates an expected call of Get.
-func (mr *MockCacherMockRecorder) Get(key interface{}) *gomock.Call {
+func (mr *MockCacherMockRecorder) Get(ctx, key interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockCacher)(nil).Get), key)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockCacher)(nil).Get), ctx, key)
 }
 
 // Shutdown mocks base method.
@@ -89,3 +93,78 @@ func (mr *MockCacherMockRecorder) Shutdown() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shutdown", reflect.TypeOf((*MockCacher)(nil).Shutdown))
 }
+
+// MockStatsProvider is a mock of StatsProvider interface.
+type MockStatsProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockStatsProviderMockRecorder
+}
+
+// MockStatsProviderMockRecorder is the mock recorder for MockStatsProvider.
+type MockStatsProviderMockRecorder struct {
+	mock *MockStatsProvider
+}
+
+// NewMockStatsProvider creates a new mock instance.
+func NewMockStatsProvider(ctrl *gomock.Controller) *MockStatsProvider {
+	mock := &MockStatsProvider{ctrl: ctrl}
+	mock.recorder = &MockStatsProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStatsProvider) EXPECT() *MockStatsProviderMockRecorder {
+	return m.recorder
+}
+
+// Stats mocks base method.
+func (m *MockStatsProvider) Stats() entities.CacheStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(entities.CacheStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats.
+func (mr *MockStatsProviderMockRecorder) Stats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockStatsProvider)(nil).Stats))
+}
+
+// MockDirectURLProvider is a mock of DirectURLProvider interface.
+type MockDirectURLProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockDirectURLProviderMockRecorder
+}
+
+// MockDirectURLProviderMockRecorder is the mock recorder for MockDirectURLProvider.
+type MockDirectURLProviderMockRecorder struct {
+	mock *MockDirectURLProvider
+}
+
+// NewMockDirectURLProvider creates a new mock instance.
+func NewMockDirectURLProvider(ctrl *gomock.Controller) *MockDirectURLProvider {
+	mock := &MockDirectURLProvider{ctrl: ctrl}
+	mock.recorder = &MockDirectURLProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDirectURLProvider) EXPECT() *MockDirectURLProviderMockRecorder {
+	return m.recorder
+}
+
+// DirectURL mocks base method.
+func (m *MockDirectURLProvider) DirectURL(key string) (string, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DirectURL", key)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// DirectURL indicates an expected call of DirectURL.
+func (mr *MockDirectURLProviderMockRecorder) DirectURL(key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DirectURL", reflect.TypeOf((*MockDirectURLProvider)(nil).DirectURL), key)
+}
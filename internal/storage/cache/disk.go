@@ -0,0 +1,270 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"interview-fm-backend/internal/entities"
+	"interview-fm-backend/internal/logger"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const tmpFilePrefix = "tmp-"
+
+// keys are hashes of image params, so only safe file names are allowed.
+var validKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+type diskEntry struct {
+	key  string
+	size int64
+}
+
+// Disk is content-addressed file storage, bounded by total size of stored files.
+// Every value is stored in separate file named by its key. Recency is kept in file modification time,
+// so LRU order survives restarts: index is rebuilt on startup from files found in directory.
+type Disk struct {
+	dir      string
+	maxBytes int64
+	log      logger.AppLogger
+
+	mu        sync.Mutex
+	size      int64
+	evictions uint64
+	order     *list.List // most recently used items are in front
+	items     map[string]*list.Element
+}
+
+func NewDiskCache(dir string, maxBytes int64, log logger.AppLogger) (*Disk, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("invalid disk cache size: %d", maxBytes)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache dir: %w", err)
+	}
+	d := &Disk{
+		dir:      dir,
+		maxBytes: maxBytes,
+		log:      log.With(zap.String("service", "disk_cache")),
+		order:    list.New(),
+		items:    map[string]*list.Element{},
+	}
+	d.log.Info("loading cache...", zap.String("dir", dir))
+	if err := d.loadIndex(); err != nil {
+		return nil, fmt.Errorf("failed to load cache index: %w", err)
+	}
+	d.log.Info("loading cache done", zap.Int("items", d.order.Len()), zap.Int64("bytes", d.size))
+	return d, nil
+}
+
+type indexFile struct {
+	key     string
+	size    int64
+	modTime time.Time
+}
+
+// loadIndex walks cache dir and restores LRU order from files modification time.
+// Temporary files left from interrupted writes are removed.
+func (d *Disk) loadIndex() error {
+	files := make([]indexFile, 0)
+	err := filepath.WalkDir(d.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), tmpFilePrefix) {
+			return os.Remove(path)
+		}
+		if !validKey.MatchString(entry.Name()) || path != d.path(entry.Name()) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, indexFile{key: entry.Name(), size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, f := range files {
+		d.items[f.key] = d.order.PushFront(&diskEntry{key: f.key, size: f.size})
+		d.size += f.size
+	}
+	d.evict()
+	return nil
+}
+
+// path returns file path for key. Files are sharded by key prefix to not keep too many files in one dir.
+func (d *Disk) path(key string) string {
+	if len(key) < 2 {
+		return filepath.Join(d.dir, key)
+	}
+	return filepath.Join(d.dir, key[:2], key)
+}
+
+func (d *Disk) Get(_ context.Context, key string) (value []byte, ok bool, err error) {
+	d.mu.Lock()
+	el, ok := d.items[key]
+	if ok {
+		d.order.MoveToFront(el)
+	}
+	d.mu.Unlock()
+	if !ok {
+		return nil, false, nil
+	}
+
+	path := d.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// file was removed outside of cache
+			d.remove(el)
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to read cache file: %w", err)
+	}
+	now := time.Now()
+	if err = os.Chtimes(path, now, now); err != nil {
+		d.log.Error("failed to touch cache file", err, zap.String("key", key))
+	}
+	return data, true, nil
+}
+
+func (d *Disk) Contains(_ context.Context, key string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.items[key]
+	return ok, nil
+}
+
+// Add writes value to temporary file and atomically moves it to destination.
+// Value bigger than cache is rejected, as it would evict all files including itself.
+func (d *Disk) Add(_ context.Context, key string, value []byte) error {
+	if !validKey.MatchString(key) {
+		return fmt.Errorf("invalid cache key: %s", key)
+	}
+	d.mu.Lock()
+	maxBytes := d.maxBytes
+	d.mu.Unlock()
+	if int64(len(value)) > maxBytes {
+		return fmt.Errorf("value is too big for cache: %d bytes", len(value))
+	}
+	path := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cache dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), tmpFilePrefix)
+	if err != nil {
+		return fmt.Errorf("failed to create cache file: %w", err)
+	}
+	_, err = tmp.Write(value)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to move cache file: %w", err)
+	}
+	if el, ok := d.items[key]; ok {
+		entry := d.entry(el)
+		d.size += int64(len(value)) - entry.size
+		entry.size = int64(len(value))
+		d.order.MoveToFront(el)
+	} else {
+		d.items[key] = d.order.PushFront(&diskEntry{key: key, size: int64(len(value))})
+		d.size += int64(len(value))
+	}
+	d.evict()
+	return nil
+}
+
+// SetCapacity changes size limit of cache. If cache is bigger than new limit, least recently used files are removed.
+func (d *Disk) SetCapacity(maxBytes int64) error {
+	if maxBytes <= 0 {
+		return fmt.Errorf("invalid disk cache size: %d", maxBytes)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.maxBytes = maxBytes
+	d.evict()
+	return nil
+}
+
+// evict removes least recently used files until cache fits into size limit. Should be called under lock.
+func (d *Disk) evict() {
+	for d.size > d.maxBytes && d.order.Len() > 0 {
+		entry := d.entry(d.order.Back())
+		if err := os.Remove(d.path(entry.key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			d.log.Error("failed to remove cache file", err, zap.String("key", entry.key))
+		}
+		d.removeElement(d.order.Back())
+		d.evictions++
+	}
+}
+
+// remove drops element from index, if it was not replaced meanwhile.
+func (d *Disk) remove(el *list.Element) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if current, ok := d.items[d.entry(el).key]; ok && current == el {
+		d.removeElement(el)
+	}
+}
+
+func (d *Disk) removeElement(el *list.Element) {
+	entry := d.entry(el)
+	d.order.Remove(el)
+	delete(d.items, entry.key)
+	d.size -= entry.size
+}
+
+func (d *Disk) entry(el *list.Element) *diskEntry {
+	entry, _ := el.Value.(*diskEntry)
+	return entry
+}
+
+// Stats returns current cache usage.
+func (d *Disk) Stats() entities.CacheStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return entities.CacheStats{
+		Items:     d.order.Len(),
+		Bytes:     d.size,
+		MaxBytes:  d.maxBytes,
+		Evictions: d.evictions,
+	}
+}
+
+// Shutdown only reports cache state, all items are already stored on disk.
+func (d *Disk) Shutdown() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.log.Info("disk cache stopped", zap.Int("items", d.order.Len()), zap.Int64("bytes", d.size))
+	return nil
+}
@@ -0,0 +1,101 @@
+package cache_test
+
+import (
+	"context"
+	"interview-fm-backend/internal/logger"
+	"interview-fm-backend/internal/storage/cache"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var log, _ = logger.NewAppLogger()
+
+func TestDisk_AddGet(t *testing.T) {
+	ctx := context.Background()
+	disk, err := cache.NewDiskCache(t.TempDir(), 1024, log)
+	require.NoError(t, err)
+
+	requireContains(t, disk, "abc", false)
+	require.NoError(t, disk.Add(ctx, "abc", []byte("123")))
+	requireContains(t, disk, "abc", true)
+	requireValue(t, disk, "abc", []byte("123"))
+
+	// override existing value
+	require.NoError(t, disk.Add(ctx, "abc", []byte("456")))
+	requireValue(t, disk, "abc", []byte("456"))
+
+	// keys which are not safe file names are not stored
+	require.Error(t, disk.Add(ctx, "../abc", []byte("123")))
+	requireContains(t, disk, "../abc", false)
+	require.NoError(t, disk.Shutdown())
+}
+
+func TestDisk_Eviction(t *testing.T) {
+	ctx := context.Background()
+	disk, err := cache.NewDiskCache(t.TempDir(), 10, log)
+	require.NoError(t, err)
+
+	require.NoError(t, disk.Add(ctx, "aaa", []byte("1234")))
+	require.NoError(t, disk.Add(ctx, "bbb", []byte("1234")))
+	requireValue(t, disk, "aaa", []byte("1234")) // aaa now most recently used
+	require.NoError(t, disk.Add(ctx, "ccc", []byte("1234")))
+
+	requireContains(t, disk, "aaa", true)
+	requireContains(t, disk, "bbb", false)
+	requireContains(t, disk, "ccc", true)
+	require.Equal(t, uint64(1), disk.Stats().Evictions)
+
+	require.NoError(t, disk.SetCapacity(5))
+	requireContains(t, disk, "aaa", false)
+	requireContains(t, disk, "ccc", true)
+	require.Equal(t, uint64(2), disk.Stats().Evictions)
+
+	// value bigger than cache is rejected without evicting other files
+	require.Error(t, disk.Add(ctx, "ddd", []byte("123456")))
+	requireContains(t, disk, "ddd", false)
+	requireContains(t, disk, "ccc", true)
+	require.Equal(t, uint64(2), disk.Stats().Evictions)
+}
+
+func TestDisk_RebuildIndex(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	disk, err := cache.NewDiskCache(dir, 1024, log)
+	require.NoError(t, err)
+	require.NoError(t, disk.Add(ctx, "aaa", []byte("123")))
+	require.NoError(t, disk.Add(ctx, "bbb", []byte("456")))
+	require.NoError(t, disk.Shutdown())
+
+	// interrupted write should be cleaned on startup
+	tmpFile := filepath.Join(dir, "aa", "tmp-123")
+	require.NoError(t, os.WriteFile(tmpFile, []byte("1"), 0o600))
+
+	restored, err := cache.NewDiskCache(dir, 1024, log)
+	require.NoError(t, err)
+	requireValue(t, restored, "aaa", []byte("123"))
+	requireContains(t, restored, "bbb", true)
+	require.NoFileExists(t, tmpFile)
+
+	// smaller limit evicts items on startup
+	limited, err := cache.NewDiskCache(dir, 3, log)
+	require.NoError(t, err)
+	require.Equal(t, 1, limited.Stats().Items)
+}
+
+func requireContains(t *testing.T, c cache.Cacher, key string, expected bool) {
+	t.Helper()
+	ok, err := c.Contains(context.Background(), key)
+	require.NoError(t, err)
+	require.Equal(t, expected, ok)
+}
+
+func requireValue(t *testing.T, c cache.Cacher, key string, expected []byte) {
+	t.Helper()
+	res, ok, err := c.Get(context.Background(), key)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, expected, res)
+}
@@ -1,46 +1,182 @@
 package cache
 
 import (
+	"container/list"
+	"context"
 	"fmt"
+	"interview-fm-backend/internal/entities"
+	"interview-fm-backend/internal/logger"
+	"sync"
 
-	lru "github.com/hashicorp/golang-lru"
+	"go.uber.org/zap"
 )
 
+// LRU is in-memory cache bounded by total size of stored values.
 type LRU struct {
-	*lru.Cache
+	maxBytes     int64
+	snapshotPath string
+	log          logger.AppLogger
+
+	mu        sync.Mutex
+	size      int64
+	evictions uint64
+	order     *list.List // most recently used items are in front
+	items     map[string]*list.Element
 }
 
-func NewCache() (Cacher, error) {
-	lruCache, err := lru.New(1024)
+// NewCache creates in-memory cache, which holds up to maxBytes of data. If snapshotPath is set, cache is restored
+// from snapshot file and dumped to it on shutdown. Broken snapshot is skipped, so cache starts empty.
+func NewCache(maxBytes int64, snapshotPath string, log logger.AppLogger) (*LRU, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("failed to create cache: invalid cache size %d", maxBytes)
+	}
+	l := &LRU{
+		maxBytes:     maxBytes,
+		snapshotPath: snapshotPath,
+		log:          log.With(zap.String("service", "lru_cache")),
+		order:        list.New(),
+		items:        map[string]*list.Element{},
+	}
+	if snapshotPath == "" {
+		return l, nil
+	}
+
+	l.log.Info("loading cache...", zap.String("snapshot", snapshotPath))
+	items, err := readSnapshot(snapshotPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create cache: %w", err)
+		l.log.Error("failed to load cache snapshot, skip it", err)
+		return l, nil
 	}
-	println("loading cache...")
-	println("loading cache done")
-	return &LRU{
-		lruCache,
-	}, nil
+	// items are stored from least to most recently used, so adding them in order restores recency
+	for i := range items {
+		l.add(items[i].Key, items[i].Val)
+	}
+	l.log.Info("loading cache done", zap.Int("items", l.Len()), zap.Int64("bytes", l.Stats().Bytes))
+	return l, nil
 }
 
-func (l *LRU) Get(key string) (value []byte, ok bool) {
-	data, ok := l.Cache.Get(key)
+func (l *LRU) Get(_ context.Context, key string) (value []byte, ok bool, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	el, ok := l.items[key]
 	if !ok {
-		return nil, false
+		return nil, false, nil
 	}
-	result, ok := data.([]byte)
-	return result, ok
+	l.order.MoveToFront(el)
+	return l.item(el).Val, true, nil
 }
 
-func (l *LRU) Contains(key string) bool {
-	return l.Cache.Contains(key)
+func (l *LRU) Contains(_ context.Context, key string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.items[key]
+	return ok, nil
 }
 
-func (l *LRU) Add(key string, value []byte) (evicted bool) {
-	return l.Cache.Add(key, value)
+// Add stores value and evicts least recently used items, until cache fits into size limit.
+// Value bigger than whole cache is not stored.
+func (l *LRU) Add(_ context.Context, key string, value []byte) error {
+	l.add(key, value)
+	return nil
 }
 
+func (l *LRU) add(key string, value []byte) {
+	size := int64(len(value))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if size > l.maxBytes {
+		l.log.Info("value is too big for cache", zap.String("key", key), zap.Int64("bytes", size))
+		return
+	}
+	if el, ok := l.items[key]; ok {
+		item := l.item(el)
+		l.size += size - int64(len(item.Val))
+		item.Val = value
+		l.order.MoveToFront(el)
+	} else {
+		l.items[key] = l.order.PushFront(&entities.CacheItem{Key: key, Val: value})
+		l.size += size
+	}
+	l.evict()
+}
+
+// SetCapacity changes size limit of cache. If cache is bigger than new limit, least recently used items are evicted.
+func (l *LRU) SetCapacity(maxBytes int64) error {
+	if maxBytes <= 0 {
+		return fmt.Errorf("invalid cache size %d", maxBytes)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxBytes = maxBytes
+	l.evict()
+	return nil
+}
+
+// evict removes least recently used items until cache fits into size limit. Should be called under lock.
+func (l *LRU) evict() {
+	for l.size > l.maxBytes {
+		l.removeElement(l.order.Back())
+		l.evictions++
+	}
+}
+
+func (l *LRU) removeElement(el *list.Element) {
+	item := l.item(el)
+	l.order.Remove(el)
+	delete(l.items, item.Key)
+	l.size -= int64(len(item.Val))
+}
+
+func (l *LRU) item(el *list.Element) *entities.CacheItem {
+	item, _ := el.Value.(*entities.CacheItem)
+	return item
+}
+
+// Len returns number of items in cache.
+func (l *LRU) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
+
+// Keys returns keys from the least to the most recently used.
+func (l *LRU) Keys() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	keys := make([]string, 0, l.order.Len())
+	for el := l.order.Back(); el != nil; el = el.Prev() {
+		keys = append(keys, l.item(el).Key)
+	}
+	return keys
+}
+
+// Stats returns current cache usage.
+func (l *LRU) Stats() entities.CacheStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return entities.CacheStats{
+		Items:     l.order.Len(),
+		Bytes:     l.size,
+		MaxBytes:  l.maxBytes,
+		Evictions: l.evictions,
+	}
+}
+
+// Shutdown dumps cache entries to snapshot file, if it configured.
 func (l *LRU) Shutdown() error {
-	println("dumping cache...")
-	println("dumping cache done")
+	if l.snapshotPath == "" {
+		return nil
+	}
+	l.log.Info("dumping cache...", zap.String("snapshot", l.snapshotPath))
+	l.mu.Lock()
+	items := make([]entities.CacheItem, 0, l.order.Len())
+	for el := l.order.Back(); el != nil; el = el.Prev() {
+		items = append(items, *l.item(el))
+	}
+	l.mu.Unlock()
+	if err := writeSnapshot(l.snapshotPath, items); err != nil {
+		return fmt.Errorf("failed to dump cache: %w", err)
+	}
+	l.log.Info("dumping cache done", zap.Int("items", len(items)))
 	return nil
 }
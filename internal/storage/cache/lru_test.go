@@ -0,0 +1,88 @@
+package cache_test
+
+import (
+	"context"
+	"interview-fm-backend/internal/entities"
+	"interview-fm-backend/internal/storage/cache"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRU_Snapshot(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "cache.snapshot")
+	lru, err := cache.NewCache(1024, snapshot, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, lru.Add(ctx, "aaa", []byte("123")))
+	require.NoError(t, lru.Add(ctx, "bbb", []byte("456")))
+	require.NoError(t, lru.Add(ctx, "ccc", []byte{}))
+	requireValue(t, lru, "aaa", []byte("123")) // aaa now most recently used
+	require.NoError(t, lru.Shutdown())
+
+	t.Run("restore from snapshot", func(t *testing.T) {
+		restored, err := cache.NewCache(1024, snapshot, log)
+		require.NoError(t, err)
+		require.Equal(t, []string{"bbb", "ccc", "aaa"}, restored.Keys())
+		requireValue(t, restored, "aaa", []byte("123"))
+	})
+	t.Run("skip truncated snapshot", func(t *testing.T) {
+		data, err := os.ReadFile(snapshot)
+		require.NoError(t, err)
+		truncated := filepath.Join(t.TempDir(), "cache.snapshot")
+		require.NoError(t, os.WriteFile(truncated, data[:len(data)-3], 0o600))
+
+		restored, err := cache.NewCache(1024, truncated, log)
+		require.NoError(t, err)
+		require.Equal(t, 0, restored.Len())
+	})
+	t.Run("skip corrupted snapshot", func(t *testing.T) {
+		data, err := os.ReadFile(snapshot)
+		require.NoError(t, err)
+		data[12] ^= 0xff
+		corrupted := filepath.Join(t.TempDir(), "cache.snapshot")
+		require.NoError(t, os.WriteFile(corrupted, data, 0o600))
+
+		restored, err := cache.NewCache(1024, corrupted, log)
+		require.NoError(t, err)
+		require.Equal(t, 0, restored.Len())
+	})
+	t.Run("missing snapshot", func(t *testing.T) {
+		restored, err := cache.NewCache(1024, filepath.Join(t.TempDir(), "missing"), log)
+		require.NoError(t, err)
+		require.Equal(t, 0, restored.Len())
+	})
+}
+
+func TestLRU_SizeLimit(t *testing.T) {
+	lru, err := cache.NewCache(10, "", log)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, lru.Add(ctx, "aaa", []byte("1234")))
+	require.NoError(t, lru.Add(ctx, "bbb", []byte("1234")))
+	requireValue(t, lru, "aaa", []byte("1234")) // aaa now most recently used
+	require.NoError(t, lru.Add(ctx, "ccc", []byte("1234")))
+	require.Equal(t, []string{"aaa", "ccc"}, lru.Keys())
+
+	// replacing value changes size
+	require.NoError(t, lru.Add(ctx, "aaa", []byte("12345678")))
+	require.Equal(t, []string{"aaa"}, lru.Keys())
+
+	// value bigger than cache is not stored
+	require.NoError(t, lru.Add(ctx, "ddd", []byte("12345678901")))
+	requireContains(t, lru, "ddd", false)
+
+	require.Equal(t, entities.CacheStats{Items: 1, Bytes: 8, MaxBytes: 10, Evictions: 2}, lru.Stats())
+
+	// shrinking cache evicts items, which don't fit anymore
+	require.NoError(t, lru.Add(ctx, "eee", []byte("12")))
+	require.NoError(t, lru.SetCapacity(5))
+	require.Equal(t, []string{"eee"}, lru.Keys())
+	require.Error(t, lru.SetCapacity(0))
+	require.NoError(t, lru.SetCapacity(20))
+	require.NoError(t, lru.Add(ctx, "fff", []byte("12345678901")))
+	require.Equal(t, entities.CacheStats{Items: 2, Bytes: 13, MaxBytes: 20, Evictions: 3}, lru.Stats())
+}
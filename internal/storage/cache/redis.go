@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"interview-fm-backend/internal/logger"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type RedisConfig struct {
+	Addr      string
+	Password  string
+	DB        int
+	KeyPrefix string        // prefix for all keys, allows share redis with other services
+	TTL       time.Duration // 0 means keys never expire, so redis eviction policy should be configured
+	PoolSize  int           // max idle connections
+	Timeout   time.Duration // dial and command timeout, if context has no closer deadline
+}
+
+// Redis is cache stored in external redis compatible service, so it can be shared between several replicas.
+type Redis struct {
+	cfg  RedisConfig
+	log  logger.AppLogger
+	idle chan *respConn
+}
+
+func NewRedisCache(ctx context.Context, cfg RedisConfig, log logger.AppLogger) (*Redis, error) {
+	if cfg.PoolSize <= 0 {
+		return nil, fmt.Errorf("invalid redis pool size: %d", cfg.PoolSize)
+	}
+	if cfg.Timeout <= 0 {
+		return nil, fmt.Errorf("invalid redis timeout: %s", cfg.Timeout)
+	}
+	r := &Redis{
+		cfg:  cfg,
+		log:  log.With(zap.String("service", "redis_cache")),
+		idle: make(chan *respConn, cfg.PoolSize),
+	}
+	reply, err := r.do(ctx, "PING")
+	if err != nil {
+		return nil, fmt.Errorf("failed to ping redis: %w", err)
+	}
+	if reply != "PONG" {
+		return nil, fmt.Errorf("unexpected ping reply: %v", reply)
+	}
+	r.log.Info("connected to redis", zap.String("addr", cfg.Addr))
+	return r, nil
+}
+
+func (r *Redis) Get(ctx context.Context, key string) (value []byte, ok bool, err error) {
+	reply, err := r.do(ctx, "GET", r.cfg.KeyPrefix+key)
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected GET reply: %T", reply)
+	}
+	return data, true, nil
+}
+
+func (r *Redis) Contains(ctx context.Context, key string) (bool, error) {
+	reply, err := r.do(ctx, "EXISTS", r.cfg.KeyPrefix+key)
+	if err != nil {
+		return false, err
+	}
+	count, ok := reply.(int64)
+	if !ok {
+		return false, fmt.Errorf("unexpected EXISTS reply: %T", reply)
+	}
+	return count > 0, nil
+}
+
+func (r *Redis) Add(ctx context.Context, key string, value []byte) error {
+	args := []interface{}{"SET", r.cfg.KeyPrefix + key, value}
+	if r.cfg.TTL > 0 {
+		args = append(args, "PX", strconv.FormatInt(r.cfg.TTL.Milliseconds(), 10))
+	}
+	_, err := r.do(ctx, args...)
+	return err
+}
+
+// Shutdown closes idle connections.
+func (r *Redis) Shutdown() error {
+	for {
+		select {
+		case conn := <-r.idle:
+			_ = conn.close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do executes command on pooled connection. Connection is returned to pool unless network error happened.
+func (r *Redis) do(ctx context.Context, args ...interface{}) (interface{}, error) {
+	conn, err := r.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.do(ctx, toBytes(args)...)
+	var respErr respError
+	if err != nil && !errors.As(err, &respErr) {
+		_ = conn.close()
+		return nil, fmt.Errorf("redis request failed: %w", err)
+	}
+	r.release(conn)
+	return reply, err
+}
+
+func (r *Redis) conn(ctx context.Context) (*respConn, error) {
+	select {
+	case conn := <-r.idle:
+		return conn, nil
+	default:
+	}
+	conn, err := dialRESP(ctx, r.cfg.Addr, r.cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if r.cfg.Password != "" {
+		if _, err = conn.do(ctx, []byte("AUTH"), []byte(r.cfg.Password)); err != nil {
+			_ = conn.close()
+			return nil, fmt.Errorf("failed to auth in redis: %w", err)
+		}
+	}
+	if r.cfg.DB != 0 {
+		if _, err = conn.do(ctx, []byte("SELECT"), []byte(strconv.Itoa(r.cfg.DB))); err != nil {
+			_ = conn.close()
+			return nil, fmt.Errorf("failed to select redis db: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (r *Redis) release(conn *respConn) {
+	select {
+	case r.idle <- conn:
+	default:
+		_ = conn.close()
+	}
+}
+
+func toBytes(args []interface{}) [][]byte {
+	res := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case []byte:
+			res = append(res, v)
+		case string:
+			res = append(res, []byte(v))
+		default:
+			res = append(res, []byte(fmt.Sprint(v)))
+		}
+	}
+	return res
+}
@@ -0,0 +1,186 @@
+package cache_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"interview-fm-backend/internal/storage/cache"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// respServer is in-process stand-in of redis, which supports only commands used by cache.
+type respServer struct {
+	listener net.Listener
+	password string
+
+	mu       sync.Mutex
+	data     map[string][]byte
+	ttl      map[string]string
+	commands []string
+}
+
+func newRESPServer(t *testing.T, password string) *respServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &respServer{listener: listener, password: password, data: map[string][]byte{}, ttl: map[string]string{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	return srv
+}
+
+func (s *respServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authorized := s.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, strings.ToUpper(args[0]))
+		var reply string
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH":
+			authorized = args[1] == s.password
+			reply = "+OK\r\n"
+			if !authorized {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authorized:
+			reply = "-NOAUTH Authentication required\r\n"
+		case cmd == "PING":
+			reply = "+PONG\r\n"
+		case cmd == "SELECT":
+			reply = "+OK\r\n"
+		case cmd == "SET":
+			s.data[args[1]] = []byte(args[2])
+			if len(args) == 5 {
+				s.ttl[args[1]] = args[3] + " " + args[4]
+			}
+			reply = "+OK\r\n"
+		case cmd == "GET":
+			val, ok := s.data[args[1]]
+			reply = "$-1\r\n"
+			if ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(val), val)
+			}
+		case cmd == "EXISTS":
+			_, ok := s.data[args[1]]
+			reply = ":0\r\n"
+			if ok {
+				reply = ":1\r\n"
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		s.mu.Unlock()
+		if _, err = io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args = append(args, string(data[:size]))
+	}
+	return args, nil
+}
+
+func redisConfig(addr string) cache.RedisConfig {
+	return cache.RedisConfig{Addr: addr, PoolSize: 2, Timeout: time.Second}
+}
+
+func TestRedis_AddGet(t *testing.T) {
+	ctx := context.Background()
+	srv := newRESPServer(t, "secret")
+	cfg := redisConfig(srv.listener.Addr().String())
+	cfg.Password = "secret"
+	cfg.DB = 2
+	cfg.KeyPrefix = "img:"
+	cfg.TTL = time.Minute
+	redis, err := cache.NewRedisCache(ctx, cfg, log)
+	require.NoError(t, err)
+
+	requireContains(t, redis, "abc", false)
+	_, ok, err := redis.Get(ctx, "abc")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	value := []byte("binary\r\n\x00data")
+	require.NoError(t, redis.Add(ctx, "abc", value))
+	requireContains(t, redis, "abc", true)
+	requireValue(t, redis, "abc", value)
+
+	srv.mu.Lock()
+	require.Equal(t, value, srv.data["img:abc"])
+	require.Equal(t, "PX 60000", srv.ttl["img:abc"])
+	// connection is reused, so auth and select are done only once
+	require.Equal(t, []string{"AUTH", "SELECT", "PING", "EXISTS", "GET", "SET", "EXISTS", "GET"}, srv.commands)
+	srv.mu.Unlock()
+	require.NoError(t, redis.Shutdown())
+}
+
+func TestRedis_Errors(t *testing.T) {
+	ctx := context.Background()
+	t.Run("wrong password", func(t *testing.T) {
+		srv := newRESPServer(t, "secret")
+		cfg := redisConfig(srv.listener.Addr().String())
+		cfg.Password = "wrong"
+		_, err := cache.NewRedisCache(ctx, cfg, log)
+		require.ErrorContains(t, err, "WRONGPASS")
+	})
+	t.Run("server is not available", func(t *testing.T) {
+		srv := newRESPServer(t, "")
+		redis, err := cache.NewRedisCache(ctx, redisConfig(srv.listener.Addr().String()), log)
+		require.NoError(t, err)
+		require.NoError(t, srv.listener.Close())
+		require.NoError(t, redis.Shutdown()) // drop pooled connection
+
+		_, err = redis.Contains(ctx, "abc")
+		require.Error(t, err)
+		_, _, err = redis.Get(ctx, "abc")
+		require.Error(t, err)
+		require.Error(t, redis.Add(ctx, "abc", []byte("123")))
+	})
+}
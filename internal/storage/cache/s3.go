@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"interview-fm-backend/internal/logger"
+	"interview-fm-backend/internal/utils"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// S3URLMode describes which url is given to clients for stored images.
+type S3URLMode string
+
+const (
+	S3URLModeProxy     S3URLMode = "proxy"     // images are served by this service
+	S3URLModePresigned S3URLMode = "presigned" // presigned bucket url, works for private buckets
+	S3URLModePublic    S3URLMode = "public"    // public bucket or CDN url
+)
+
+type S3Config struct {
+	Endpoint      string // storage url, like `https://s3.amazonaws.com` or `http://localhost:9000`
+	Bucket        string
+	Region        string
+	AccessKey     string
+	SecretKey     string
+	KeyPrefix     string
+	URLMode       S3URLMode
+	PublicURL     string        // base url for public mode, endpoint with bucket is used if empty
+	PresignExpiry time.Duration // lifetime of presigned urls
+	Timeout       time.Duration
+}
+
+// S3 stores images in S3 compatible bucket. Path-style urls are used, so it works with MinIO and other storages.
+type S3 struct {
+	cfg    S3Config
+	base   *url.URL
+	signer utils.SigV4
+	client *http.Client
+	log    logger.AppLogger
+}
+
+func NewS3Cache(cfg S3Config, log logger.AppLogger) (*S3, error) {
+	base, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/") + "/" + cfg.Bucket)
+	if err != nil || base.Host == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint or bucket: %s/%s", cfg.Endpoint, cfg.Bucket)
+	}
+	switch cfg.URLMode {
+	case S3URLModeProxy, S3URLModePublic:
+	case S3URLModePresigned:
+		if cfg.PresignExpiry <= 0 {
+			return nil, fmt.Errorf("invalid presign expiry: %s", cfg.PresignExpiry)
+		}
+	default:
+		return nil, fmt.Errorf("unknown s3 url mode: %s", cfg.URLMode)
+	}
+	if cfg.PublicURL == "" {
+		cfg.PublicURL = base.String()
+	}
+	return &S3{
+		cfg:  cfg,
+		base: base,
+		signer: utils.SigV4{
+			AccessKey: cfg.AccessKey,
+			SecretKey: cfg.SecretKey,
+			Region:    cfg.Region,
+			Service:   "s3",
+		},
+		client: &http.Client{Timeout: cfg.Timeout},
+		log:    log.With(zap.String("service", "s3_cache")),
+	}, nil
+}
+
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.base
+	u.Path += "/" + s.cfg.KeyPrefix + key
+	return &u
+}
+
+func (s *S3) Get(ctx context.Context, key string) (value []byte, ok bool, err error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read s3 object: %w", err)
+		}
+		return data, true, nil
+	case http.StatusNotFound:
+		return nil, false, nil
+	}
+	return nil, false, fmt.Errorf("unexpected s3 status on get: %d", resp.StatusCode)
+}
+
+func (s *S3) Contains(ctx context.Context, key string) (bool, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return false, err
+	}
+	_ = resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("unexpected s3 status on head: %d", resp.StatusCode)
+}
+
+// Add uploads image with detected content type, so bucket urls are rendered by browsers.
+func (s *S3) Add(ctx context.Context, key string, value []byte) error {
+	resp, err := s.do(ctx, http.MethodPut, key, value)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected s3 status on put: %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (s *S3) do(ctx context.Context, method, key string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 request: %w", err)
+	}
+	payloadHash := sha256.Sum256(body)
+	if body != nil {
+		contentType := "application/octet-stream"
+		if format, err := utils.DetectImageFormat(body); err == nil {
+			contentType = format.ContentType()
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.signer.Sign(req, hex.EncodeToString(payloadHash[:]), time.Now())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// DirectURL returns bucket url of image, if service is configured to give bucket urls to clients.
+func (s *S3) DirectURL(key string) (string, bool) {
+	switch s.cfg.URLMode {
+	case S3URLModePublic:
+		return strings.TrimSuffix(s.cfg.PublicURL, "/") + "/" + s.cfg.KeyPrefix + key, true
+	case S3URLModePresigned:
+		return s.signer.Presign(http.MethodGet, s.objectURL(key), s.cfg.PresignExpiry, time.Now()), true
+	case S3URLModeProxy:
+	}
+	return "", false
+}
+
+// Shutdown closes idle connections to storage.
+func (s *S3) Shutdown() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
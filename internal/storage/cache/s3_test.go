@@ -0,0 +1,146 @@
+package cache_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"interview-fm-backend/internal/entities"
+	"interview-fm-backend/internal/storage/cache"
+	"interview-fm-backend/internal/utils"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// s3Server is in-process stand-in of S3 compatible storage. It checks only presence of signature.
+type s3Server struct {
+	*httptest.Server
+	mu           sync.Mutex
+	objects      map[string][]byte
+	contentTypes map[string]string
+}
+
+func newS3Server(t *testing.T) *s3Server {
+	srv := &s3Server{objects: map[string][]byte{}, contentTypes: map[string]string{}}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorized := strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") ||
+			r.URL.Query().Get("X-Amz-Signature") != ""
+		if !authorized {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			hash := sha256.Sum256(body)
+			if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(hash[:]) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			srv.objects[r.URL.Path] = body
+			srv.contentTypes[r.URL.Path] = r.Header.Get("Content-Type")
+		case http.MethodGet, http.MethodHead:
+			data, ok := srv.objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(data)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func s3Config(endpoint string) cache.S3Config {
+	return cache.S3Config{
+		Endpoint:  endpoint,
+		Bucket:    "images",
+		Region:    "us-east-1",
+		AccessKey: "access",
+		SecretKey: "secret",
+		KeyPrefix: "resized/",
+		URLMode:   cache.S3URLModeProxy,
+		Timeout:   time.Second,
+	}
+}
+
+func TestS3_AddGet(t *testing.T) {
+	ctx := context.Background()
+	srv := newS3Server(t)
+	s3, err := cache.NewS3Cache(s3Config(srv.URL), log)
+	require.NoError(t, err)
+
+	requireContains(t, s3, "abc", false)
+	_, ok, err := s3.Get(ctx, "abc")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	png, err := utils.EncodeImage(image.NewNRGBA(image.Rect(0, 0, 1, 1)), entities.ImageFormatPNG, 0)
+	require.NoError(t, err)
+	require.NoError(t, s3.Add(ctx, "abc", png))
+	requireContains(t, s3, "abc", true)
+	requireValue(t, s3, "abc", png)
+	srv.mu.Lock()
+	require.Equal(t, "image/png", srv.contentTypes["/images/resized/abc"])
+	srv.mu.Unlock()
+
+	_, ok = s3.DirectURL("abc")
+	require.False(t, ok)
+	require.NoError(t, s3.Shutdown())
+}
+
+func TestS3_DirectURL(t *testing.T) {
+	srv := newS3Server(t)
+	t.Run("public", func(t *testing.T) {
+		cfg := s3Config(srv.URL)
+		cfg.URLMode = cache.S3URLModePublic
+		cfg.PublicURL = "https://cdn.example.com/"
+		s3, err := cache.NewS3Cache(cfg, log)
+		require.NoError(t, err)
+		res, ok := s3.DirectURL("abc")
+		require.True(t, ok)
+		require.Equal(t, "https://cdn.example.com/resized/abc", res)
+	})
+	t.Run("presigned", func(t *testing.T) {
+		cfg := s3Config(srv.URL)
+		cfg.URLMode = cache.S3URLModePresigned
+		cfg.PresignExpiry = time.Hour
+		s3, err := cache.NewS3Cache(cfg, log)
+		require.NoError(t, err)
+		require.NoError(t, s3.Add(context.Background(), "abc", []byte("123")))
+
+		res, ok := s3.DirectURL("abc")
+		require.True(t, ok)
+		require.True(t, strings.HasPrefix(res, srv.URL+"/images/resized/abc?"))
+		require.Contains(t, res, "X-Amz-Expires=3600")
+
+		resp, err := http.Get(res)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, []byte("123"), body)
+	})
+	t.Run("invalid config", func(t *testing.T) {
+		cfg := s3Config(srv.URL)
+		cfg.URLMode = cache.S3URLModePresigned
+		_, err := cache.NewS3Cache(cfg, log)
+		require.Error(t, err)
+
+		cfg = s3Config("")
+		_, err = cache.NewS3Cache(cfg, log)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"interview-fm-backend/internal/entities"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Snapshot file layout, all numbers are big endian:
+//
+//	magic[4] version[2] count[4] (keyLen[4] key valLen[4] val)*count crc32[4]
+//
+// Checksum covers everything before it, so truncated or corrupted file is detected before loading.
+const (
+	snapshotMagic   = "LRUS"
+	snapshotVersion = uint16(1)
+	snapshotHeader  = len(snapshotMagic) + 2 + 4
+	checksumSize    = 4
+)
+
+var errSnapshotCorrupted = errors.New("snapshot is corrupted")
+
+// writeSnapshot stores items to file. Data is written into temporary file first and than renamed,
+// so crash during write never breaks previous snapshot.
+func writeSnapshot(path string, items []entities.CacheItem) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	checksum := crc32.NewIEEE()
+	w := bufio.NewWriter(io.MultiWriter(tmp, checksum))
+	header := make([]byte, snapshotHeader)
+	copy(header, snapshotMagic)
+	binary.BigEndian.PutUint16(header[4:], snapshotVersion)
+	binary.BigEndian.PutUint32(header[6:], uint32(len(items)))
+	_, err = w.Write(header)
+	for i := 0; i < len(items) && err == nil; i++ {
+		err = writeChunk(w, []byte(items[i].Key))
+		if err == nil {
+			err = writeChunk(w, items[i].Val)
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = binary.Write(tmp, binary.BigEndian, checksum.Sum32())
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func writeChunk(w io.Writer, data []byte) error {
+	if err := binary.Write(w, binary.BigEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readSnapshot loads items from file in the same order as they were written.
+// Missing file is not an error, it means that there is nothing to restore.
+func readSnapshot(path string) ([]entities.CacheItem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	if len(data) < snapshotHeader+checksumSize {
+		return nil, errSnapshotCorrupted
+	}
+	body, sum := data[:len(data)-checksumSize], data[len(data)-checksumSize:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return nil, errSnapshotCorrupted
+	}
+	if string(body[:4]) != snapshotMagic {
+		return nil, errSnapshotCorrupted
+	}
+	if version := binary.BigEndian.Uint16(body[4:]); version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version: %d", version)
+	}
+
+	count := binary.BigEndian.Uint32(body[6:])
+	r := bytes.NewReader(body[snapshotHeader:])
+	items := make([]entities.CacheItem, 0, count)
+	for i := uint32(0); i < count; i++ {
+		key, err := readChunk(r)
+		if err != nil {
+			return nil, err
+		}
+		val, err := readChunk(r)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, entities.CacheItem{Key: string(key), Val: val})
+	}
+	if r.Len() != 0 {
+		return nil, errSnapshotCorrupted
+	}
+	return items, nil
+}
+
+func readChunk(r *bytes.Reader) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, errSnapshotCorrupted
+	}
+	if int64(size) > int64(r.Len()) {
+		return nil, errSnapshotCorrupted
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, errSnapshotCorrupted
+	}
+	return data, nil
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"interview-fm-backend/internal/entities"
+	"interview-fm-backend/internal/logger"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+const (
+	tierMemory  = "memory"
+	tierDurable = "durable"
+)
+
+type tierCounters struct {
+	hits   uint64
+	misses uint64
+}
+
+// TwoTier is cache, which reads through fast memory tier to slower durable tier (disk or remote storage).
+// Items found in durable tier are promoted into memory, new items are written to both tiers.
+type TwoTier struct {
+	memory  *LRU
+	durable Cacher
+	log     logger.AppLogger
+
+	memoryCounters  tierCounters
+	durableCounters tierCounters
+}
+
+func NewTwoTierCache(memory *LRU, durable Cacher, log logger.AppLogger) *TwoTier {
+	return &TwoTier{
+		memory:  memory,
+		durable: durable,
+		log:     log.With(zap.String("service", "two_tier_cache")),
+	}
+}
+
+func (t *TwoTier) Get(ctx context.Context, key string) (value []byte, ok bool, err error) {
+	value, ok, _ = t.memory.Get(ctx, key)
+	if ok {
+		atomic.AddUint64(&t.memoryCounters.hits, 1)
+		return value, true, nil
+	}
+	atomic.AddUint64(&t.memoryCounters.misses, 1)
+
+	value, ok, err = t.durable.Get(ctx, key)
+	if err != nil {
+		return nil, false, err
+	}
+	if !ok {
+		atomic.AddUint64(&t.durableCounters.misses, 1)
+		return nil, false, nil
+	}
+	atomic.AddUint64(&t.durableCounters.hits, 1)
+	_ = t.memory.Add(ctx, key, value)
+	return value, true, nil
+}
+
+func (t *TwoTier) Contains(ctx context.Context, key string) (bool, error) {
+	if ok, _ := t.memory.Contains(ctx, key); ok {
+		return true, nil
+	}
+	return t.durable.Contains(ctx, key)
+}
+
+// Add writes item to durable tier first, so item is never kept only in memory.
+func (t *TwoTier) Add(ctx context.Context, key string, value []byte) error {
+	if err := t.durable.Add(ctx, key, value); err != nil {
+		return err
+	}
+	return t.memory.Add(ctx, key, value)
+}
+
+// Stats returns usage of both tiers. Top level hits are hits in any tier, misses are misses in both tiers.
+func (t *TwoTier) Stats() entities.CacheStats {
+	memory := t.memory.Stats()
+	memory.Hits = atomic.LoadUint64(&t.memoryCounters.hits)
+	memory.Misses = atomic.LoadUint64(&t.memoryCounters.misses)
+
+	var durable entities.CacheStats
+	if provider, ok := t.durable.(StatsProvider); ok {
+		durable = provider.Stats()
+	}
+	durable.Hits = atomic.LoadUint64(&t.durableCounters.hits)
+	durable.Misses = atomic.LoadUint64(&t.durableCounters.misses)
+
+	return entities.CacheStats{
+		Items:     memory.Items,
+		Bytes:     memory.Bytes,
+		MaxBytes:  memory.MaxBytes,
+		Evictions: memory.Evictions,
+		Hits:      memory.Hits + durable.Hits,
+		Misses:    durable.Misses,
+		Tiers: map[string]entities.CacheStats{
+			tierMemory:  memory,
+			tierDurable: durable,
+		},
+	}
+}
+
+// Tiers returns memory and durable tiers of cache.
+func (t *TwoTier) Tiers() (memory *LRU, durable Cacher) {
+	return t.memory, t.durable
+}
+
+// DirectURL returns url of durable tier, if it can serve images to clients.
+func (t *TwoTier) DirectURL(key string) (string, bool) {
+	if provider, ok := t.durable.(DirectURLProvider); ok {
+		return provider.DirectURL(key)
+	}
+	return "", false
+}
+
+// Shutdown stops both tiers.
+func (t *TwoTier) Shutdown() error {
+	t.log.Info("cache stats on shutdown", zap.Any("stats", t.Stats()))
+	memoryErr := t.memory.Shutdown()
+	if err := t.durable.Shutdown(); err != nil {
+		return fmt.Errorf("failed to shutdown durable tier: %w", err)
+	}
+	return memoryErr
+}
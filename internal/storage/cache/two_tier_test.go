@@ -0,0 +1,48 @@
+package cache_test
+
+import (
+	"context"
+	"interview-fm-backend/internal/storage/cache"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwoTier(t *testing.T) {
+	ctx := context.Background()
+	memory, err := cache.NewCache(1024, "", log)
+	require.NoError(t, err)
+	durable, err := cache.NewDiskCache(t.TempDir(), 1024, log)
+	require.NoError(t, err)
+	tiered := cache.NewTwoTierCache(memory, durable, log)
+
+	// write through to both tiers
+	require.NoError(t, tiered.Add(ctx, "aaa", []byte("123")))
+	requireContains(t, memory, "aaa", true)
+	requireContains(t, durable, "aaa", true)
+
+	// item only in durable tier is promoted to memory
+	require.NoError(t, durable.Add(ctx, "bbb", []byte("456")))
+	requireContains(t, tiered, "bbb", true)
+	requireContains(t, memory, "bbb", false)
+	requireValue(t, tiered, "bbb", []byte("456"))
+	requireContains(t, memory, "bbb", true)
+
+	requireValue(t, tiered, "aaa", []byte("123"))
+	_, ok, err := tiered.Get(ctx, "ccc")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	stats := tiered.Stats()
+	require.Equal(t, uint64(1), stats.Tiers["memory"].Hits)
+	require.Equal(t, uint64(2), stats.Tiers["memory"].Misses)
+	require.Equal(t, uint64(1), stats.Tiers["durable"].Hits)
+	require.Equal(t, uint64(1), stats.Tiers["durable"].Misses)
+	require.Equal(t, 2, stats.Tiers["durable"].Items)
+	require.Equal(t, uint64(2), stats.Hits)
+	require.Equal(t, uint64(1), stats.Misses)
+
+	_, ok = tiered.DirectURL("aaa")
+	require.False(t, ok)
+	require.NoError(t, tiered.Shutdown())
+}
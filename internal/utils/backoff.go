@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff gives delays between retries, which grow exponentially from initial to max delay.
+type Backoff struct {
+	next time.Duration
+	max  time.Duration
+}
+
+func NewBackoff(initial, max time.Duration) *Backoff {
+	return &Backoff{next: initial, max: max}
+}
+
+// Next returns delay before next attempt and doubles following one. Delay is randomized in range [backoff/2, backoff],
+// so clients failed at the same time don't retry at the same time.
+func (b *Backoff) Next() time.Duration {
+	backoff := b.next
+	if b.next *= 2; b.next > b.max {
+		b.next = b.max
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1)) //nolint:gosec // jitter doesn't need secure random
+}
@@ -0,0 +1,19 @@
+package utils_test
+
+import (
+	"interview-fm-backend/internal/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	backoff := utils.NewBackoff(100*time.Millisecond, 300*time.Millisecond)
+	for _, limit := range []time.Duration{100, 200, 300, 300} {
+		limit *= time.Millisecond
+		delay := backoff.Next()
+		require.GreaterOrEqual(t, delay, limit/2)
+		require.LessOrEqual(t, delay, limit)
+	}
+}
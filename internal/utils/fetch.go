@@ -5,29 +5,80 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-func FetchURL(ctx context.Context, url string) ([]byte, error) {
+// StatusError is returned by FetchURL for non-200 responses.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration // delay requested by server in `Retry-After` header, zero if not set
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("non-200 status: %d", e.StatusCode)
+}
+
+// FetchResult is downloaded response.
+type FetchResult struct {
+	Data        []byte
+	Header      http.Header
+	NotModified bool // conditional request got 304 status, data is empty
+}
+
+// FetchURL downloads url by client with additional request header. Responses bigger than maxSize bytes are rejected.
+// 304 status is accepted only if header contains `If-None-Match` or `If-Modified-Since`.
+func FetchURL(ctx context.Context, client *http.Client, url string, header http.Header, maxSize int64) (FetchResult, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return FetchResult{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
 	}
-	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch url: %w", err)
+		return FetchResult{}, fmt.Errorf("failed to fetch url: %w", err)
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
 
+	conditional := req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != ""
+	if resp.StatusCode == http.StatusNotModified && conditional {
+		return FetchResult{Header: resp.Header, NotModified: true}, nil
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("non-200 status: %d", resp.StatusCode)
+		return FetchResult{}, &StatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
 	}
 
-	data, err := io.ReadAll(io.LimitReader(resp.Body, 15*1024*1024))
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read fetch data: %w", err)
+		return FetchResult{}, fmt.Errorf("failed to read fetch data: %w", err)
+	}
+	if int64(len(data)) > maxSize {
+		return FetchResult{}, fmt.Errorf("image is bigger than %d bytes", maxSize)
+	}
+	return FetchResult{Data: data, Header: resp.Header}, nil
+}
+
+// parseRetryAfter parses `Retry-After` header, which is either delay in seconds or HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	date, err := http.ParseTime(value)
+	if err != nil || date.Before(now) {
+		return 0
 	}
-	return data, nil
+	return date.Sub(now)
 }
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// ErrAddressNotAllowed is returned when host is resolved to address of internal or special network.
+var ErrAddressNotAllowed = errors.New("address is not allowed")
+
+// blockedNetworks are special networks, which are not covered by netip.Addr checks
+// of loopback, private, link-local, multicast and unspecified addresses.
+var blockedNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, including broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, can point to any IPv4 address
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("100::/64"),        // discard-only
+	netip.MustParsePrefix("2001::/32"),       // Teredo, can point to any IPv4 address
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4, can point to any IPv4 address
+	netip.MustParsePrefix("fec0::/10"),       // deprecated site-local
+}
+
+// AddressAllowed checks that address is not loopback, private, link-local or other special address.
+// Allowed networks are exceptions from these checks.
+func AddressAllowed(addr netip.Addr, allowed []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, network := range allowed {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// GuardedControl returns control hook of net.Dialer, which is called after host is resolved,
+// so connection is never opened to blocked address, even if DNS answer is changed after checks of url.
+// Allowed returns current exceptions from blocked networks.
+func GuardedControl(allowed func() []netip.Prefix) func(network, address string, c syscall.RawConn) error {
+	return func(_, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrAddressNotAllowed, address)
+		}
+		addr, err := netip.ParseAddr(host)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrAddressNotAllowed, address)
+		}
+		if !AddressAllowed(addr, allowed()) {
+			return fmt.Errorf("%w: %s", ErrAddressNotAllowed, addr.Unmap())
+		}
+		return nil
+	}
+}
+
+// CheckHost resolves host and checks all its addresses, so urls of internal hosts can be rejected before use.
+// It doesn't replace GuardedControl, as DNS answer can be changed after check.
+func CheckHost(ctx context.Context, host string, allowed []netip.Prefix) error {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if !AddressAllowed(addr, allowed) {
+			return fmt.Errorf("%w: %s", ErrAddressNotAllowed, host)
+		}
+	}
+	return nil
+}
@@ -1,27 +1,165 @@
 package utils
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
 	"image/jpeg"
+	"image/png"
+	"interview-fm-backend/internal/entities"
+	"math"
 
 	jpgresize "github.com/nfnt/resize"
+	_ "golang.org/x/image/webp" // register webp decoder
 )
 
-func ResizeImage(data []byte, width uint, height uint) ([]byte, error) {
-	// decode jpeg into image.Image
-	img, err := jpeg.Decode(bytes.NewReader(data))
+// ResizeImage decodes image in any registered format, resizes it and encodes in requested format.
+// If format is not set in params, image is encoded back in the source format.
+func ResizeImage(data []byte, params entities.ResizeParams) ([]byte, entities.ImageFormat, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
-		return nil, fmt.Errorf("failed to jped decode: %w", err)
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
 	}
 
-	// if either width or height is 0, it will resize respecting the aspect ratio
-	newImage := jpgresize.Resize(width, height, img, jpgresize.Lanczos3)
+	newImage, err := resizeByMode(img, params)
+	if err != nil {
+		return nil, "", err
+	}
+
+	imageFormat := params.Format
+	if imageFormat == "" {
+		imageFormat = entities.ImageFormat(format)
+	}
+	newData, err := EncodeImage(newImage, imageFormat, params.Quality)
+	if err != nil {
+		return nil, "", err
+	}
+	return newData, imageFormat, nil
+}
+
+func interpolationFunction(interpolation entities.Interpolation) (jpgresize.InterpolationFunction, error) {
+	switch interpolation {
+	case entities.InterpolationNearestNeighbor:
+		return jpgresize.NearestNeighbor, nil
+	case entities.InterpolationBilinear:
+		return jpgresize.Bilinear, nil
+	case entities.InterpolationBicubic:
+		return jpgresize.Bicubic, nil
+	case entities.InterpolationMitchellNetravali:
+		return jpgresize.MitchellNetravali, nil
+	case entities.InterpolationLanczos2:
+		return jpgresize.Lanczos2, nil
+	case entities.InterpolationDefault, entities.InterpolationLanczos3:
+		return jpgresize.Lanczos3, nil
+	}
+	return 0, fmt.Errorf("unsupported interpolation: %s", interpolation)
+}
+
+func resizeByMode(img image.Image, params entities.ResizeParams) (image.Image, error) {
+	interp, err := interpolationFunction(params.Interpolation)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	switch params.Mode {
+	case entities.ResizeModeStretch:
+		// if either width or height is 0, it will resize respecting the aspect ratio
+		return jpgresize.Resize(params.Width, params.Height, img, interp), nil
+	case entities.ResizeModeFit:
+		width, height := scaledSize(bounds, params.Width, params.Height, false)
+		return jpgresize.Resize(width, height, img, interp), nil
+	case entities.ResizeModeFill:
+		width, height := scaledSize(bounds, params.Width, params.Height, true)
+		scaled := jpgresize.Resize(width, height, img, interp)
+		dst := image.NewNRGBA(image.Rect(0, 0, int(params.Width), int(params.Height)))
+		offset, err := gravityOffset(params.Gravity, scaled.Bounds().Size().Sub(dst.Rect.Size()))
+		if err != nil {
+			return nil, err
+		}
+		draw.Draw(dst, dst.Rect, scaled, scaled.Bounds().Min.Add(offset), draw.Src)
+		return dst, nil
+	case entities.ResizeModePad:
+		background := params.Background
+		if background == "" {
+			background = entities.DefaultBackground
+		}
+		bg, err := entities.ParseHexColor(background)
+		if err != nil {
+			return nil, err
+		}
+		width, height := scaledSize(bounds, params.Width, params.Height, false)
+		scaled := jpgresize.Resize(width, height, img, interp)
+		dst := image.NewNRGBA(image.Rect(0, 0, int(params.Width), int(params.Height)))
+		draw.Draw(dst, dst.Rect, image.NewUniform(bg), image.Point{}, draw.Src)
+		offset, err := gravityOffset(params.Gravity, dst.Rect.Size().Sub(scaled.Bounds().Size()))
+		if err != nil {
+			return nil, err
+		}
+		draw.Draw(dst, scaled.Bounds().Sub(scaled.Bounds().Min).Add(offset), scaled, scaled.Bounds().Min, draw.Over)
+		return dst, nil
+	}
+	return nil, fmt.Errorf("unsupported resize mode: %s", params.Mode)
+}
+
+// scaledSize calculates size of image scaled with kept aspect ratio to fit (or cover) bounding box.
+// Zero width or height means that dimension is not limited.
+func scaledSize(bounds image.Rectangle, width, height uint, cover bool) (uint, uint) {
+	srcWidth, srcHeight := float64(bounds.Dx()), float64(bounds.Dy())
+	scaleX, scaleY := float64(width)/srcWidth, float64(height)/srcHeight
+	scale := math.Min(scaleX, scaleY)
+	switch {
+	case width == 0:
+		scale = scaleY
+	case height == 0:
+		scale = scaleX
+	case cover:
+		scale = math.Max(scaleX, scaleY)
+	}
+	return uint(math.Max(1, math.Round(srcWidth*scale))), uint(math.Max(1, math.Round(srcHeight*scale)))
+}
+
+// gravityOffset returns offset for placing item inside free space by gravity.
+func gravityOffset(gravity entities.Gravity, free image.Point) (image.Point, error) {
+	x, y, err := gravity.Position()
+	if err != nil {
+		return image.Point{}, err
+	}
+	return image.Point{X: free.X * x / 2, Y: free.Y * y / 2}, nil
+}
 
+// EncodeImage encodes image into given format. Quality is used only by jpeg encoder, 0 means default quality.
+func EncodeImage(img image.Image, format entities.ImageFormat, quality int) ([]byte, error) {
 	newData := bytes.Buffer{}
-	if err = jpeg.Encode(bufio.NewWriter(&newData), newImage, nil); err != nil {
-		return nil, fmt.Errorf("failed to jpeg encode resized image: %w", err)
+	var err error
+	switch format {
+	case entities.ImageFormatJPEG:
+		var opts *jpeg.Options
+		if quality > 0 {
+			opts = &jpeg.Options{Quality: quality}
+		}
+		err = jpeg.Encode(&newData, img, opts)
+	case entities.ImageFormatPNG:
+		err = png.Encode(&newData, img)
+	case entities.ImageFormatGIF:
+		err = gif.Encode(&newData, img, nil)
+	case entities.ImageFormatWebP:
+		err = EncodeWebPLossless(&newData, img)
+	default:
+		return nil, fmt.Errorf("unsupported image format: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s encode resized image: %w", format, err)
 	}
 	return newData.Bytes(), nil
 }
+
+// DetectImageFormat sniffs image format from data header using registered decoders.
+func DetectImageFormat(data []byte) (entities.ImageFormat, error) {
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to detect image format: %w", err)
+	}
+	return entities.ImageFormat(format), nil
+}
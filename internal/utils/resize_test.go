@@ -0,0 +1,179 @@
+package utils_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"interview-fm-backend/internal/entities"
+	"interview-fm-backend/internal/utils"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/webp"
+)
+
+func sampleImage(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 7), G: uint8(y * 13), B: uint8(x + y), A: uint8(255 - x)})
+		}
+	}
+	return img
+}
+
+func TestResizeImage(t *testing.T) {
+	table := []entities.ImageFormat{
+		entities.ImageFormatJPEG,
+		entities.ImageFormatPNG,
+		entities.ImageFormatGIF,
+		entities.ImageFormatWebP,
+	}
+	for _, format := range table {
+		t.Run(string(format), func(t *testing.T) {
+			src, err := utils.EncodeImage(sampleImage(40, 20), format, 0)
+			require.NoError(t, err)
+
+			res, resFormat, err := utils.ResizeImage(src, entities.ResizeParams{Width: 10})
+			require.NoError(t, err)
+			require.Equal(t, format, resFormat)
+
+			cfg, detected, err := image.DecodeConfig(bytes.NewReader(res))
+			require.NoError(t, err)
+			require.Equal(t, string(format), detected)
+			require.Equal(t, 10, cfg.Width)
+			require.Equal(t, 5, cfg.Height)
+		})
+	}
+	t.Run("convert format", func(t *testing.T) {
+		src, err := utils.EncodeImage(sampleImage(40, 20), entities.ImageFormatPNG, 0)
+		require.NoError(t, err)
+
+		res, resFormat, err := utils.ResizeImage(src, entities.ResizeParams{Width: 10, Format: entities.ImageFormatJPEG, Quality: 60})
+		require.NoError(t, err)
+		require.Equal(t, entities.ImageFormatJPEG, resFormat)
+		_, detected, err := image.DecodeConfig(bytes.NewReader(res))
+		require.NoError(t, err)
+		require.Equal(t, "jpeg", detected)
+	})
+	t.Run("jpeg quality", func(t *testing.T) {
+		img := sampleImage(64, 64)
+		low, err := utils.EncodeImage(img, entities.ImageFormatJPEG, 10)
+		require.NoError(t, err)
+		high, err := utils.EncodeImage(img, entities.ImageFormatJPEG, 95)
+		require.NoError(t, err)
+		require.Less(t, len(low), len(high))
+	})
+	t.Run("unknown format", func(t *testing.T) {
+		_, _, err := utils.ResizeImage([]byte("not an image"), entities.ResizeParams{Width: 10, Height: 10})
+		require.Error(t, err)
+	})
+}
+
+func TestResizeImage_Modes(t *testing.T) {
+	red, blue := color.NRGBA{R: 255, A: 255}, color.NRGBA{B: 255, A: 255}
+	// left half is red, right half is blue
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 20; y++ {
+			if x < 20 {
+				img.SetNRGBA(x, y, red)
+			} else {
+				img.SetNRGBA(x, y, blue)
+			}
+		}
+	}
+	src, err := utils.EncodeImage(img, entities.ImageFormatPNG, 0)
+	require.NoError(t, err)
+
+	resize := func(params entities.ResizeParams) image.Image {
+		res, _, err := utils.ResizeImage(src, params)
+		require.NoError(t, err)
+		resImage, _, err := image.Decode(bytes.NewReader(res))
+		require.NoError(t, err)
+		return resImage
+	}
+	at := func(img image.Image, x, y int) color.NRGBA {
+		c, ok := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+		require.True(t, ok)
+		return c
+	}
+
+	t.Run("stretch", func(t *testing.T) {
+		res := resize(entities.ResizeParams{Width: 10, Height: 10})
+		require.Equal(t, image.Pt(10, 10), res.Bounds().Size())
+	})
+	t.Run("fit", func(t *testing.T) {
+		res := resize(entities.ResizeParams{Width: 10, Height: 10, Mode: entities.ResizeModeFit})
+		require.Equal(t, image.Pt(10, 5), res.Bounds().Size())
+	})
+	t.Run("fit by single dimension", func(t *testing.T) {
+		res := resize(entities.ResizeParams{Height: 10, Mode: entities.ResizeModeFit})
+		require.Equal(t, image.Pt(20, 10), res.Bounds().Size())
+	})
+	t.Run("fill with gravity", func(t *testing.T) {
+		res := resize(entities.ResizeParams{Width: 10, Height: 10, Mode: entities.ResizeModeFill, Gravity: entities.GravityWest})
+		require.Equal(t, image.Pt(10, 10), res.Bounds().Size())
+		require.Equal(t, red, at(res, 4, 5))
+
+		res = resize(entities.ResizeParams{Width: 10, Height: 10, Mode: entities.ResizeModeFill, Gravity: entities.GravityEast})
+		require.Equal(t, blue, at(res, 5, 5))
+	})
+	t.Run("interpolation", func(t *testing.T) {
+		table := []entities.Interpolation{
+			entities.InterpolationDefault,
+			entities.InterpolationNearestNeighbor,
+			entities.InterpolationBilinear,
+			entities.InterpolationBicubic,
+			entities.InterpolationMitchellNetravali,
+			entities.InterpolationLanczos2,
+			entities.InterpolationLanczos3,
+		}
+		for _, interpolation := range table {
+			res := resize(entities.ResizeParams{Width: 10, Height: 10, Mode: entities.ResizeModeFit, Interpolation: interpolation})
+			require.Equal(t, image.Pt(10, 5), res.Bounds().Size())
+		}
+		_, _, err := utils.ResizeImage(src, entities.ResizeParams{Width: 10, Interpolation: "unknown"})
+		require.Error(t, err)
+	})
+	t.Run("pad with background", func(t *testing.T) {
+		res := resize(entities.ResizeParams{Width: 10, Height: 10, Mode: entities.ResizeModePad, Background: "00ff00"})
+		require.Equal(t, image.Pt(10, 10), res.Bounds().Size())
+		require.Equal(t, color.NRGBA{G: 255, A: 255}, at(res, 5, 0))
+		require.Equal(t, color.NRGBA{G: 255, A: 255}, at(res, 5, 9))
+		require.Equal(t, red, at(res, 0, 5))
+
+		res = resize(entities.ResizeParams{Width: 10, Height: 10, Mode: entities.ResizeModePad, Gravity: entities.GravityNorth})
+		require.Equal(t, red, at(res, 0, 0))
+		require.Equal(t, color.NRGBA{R: 255, G: 255, B: 255, A: 255}, at(res, 5, 9))
+	})
+}
+
+func TestEncodeWebPLossless(t *testing.T) {
+	t.Run("transparent image", func(t *testing.T) {
+		src := sampleImage(33, 17)
+		buf := bytes.Buffer{}
+		require.NoError(t, utils.EncodeWebPLossless(&buf, src))
+
+		res, err := webp.Decode(&buf)
+		require.NoError(t, err)
+		for x := 0; x < 33; x++ {
+			for y := 0; y < 17; y++ {
+				require.Equal(t, src.NRGBAAt(x, y), color.NRGBAModel.Convert(res.At(x, y)))
+			}
+		}
+	})
+	t.Run("opaque image", func(t *testing.T) {
+		src := image.NewRGBA(image.Rect(0, 0, 3, 3))
+		src.Set(1, 1, color.RGBA{R: 10, G: 20, B: 30, A: 255})
+		for i := 3; i < len(src.Pix); i += 4 {
+			src.Pix[i] = 255
+		}
+		buf := bytes.Buffer{}
+		require.NoError(t, utils.EncodeWebPLossless(&buf, src))
+
+		res, err := webp.Decode(&buf)
+		require.NoError(t, err)
+		require.Equal(t, color.NRGBA{R: 10, G: 20, B: 30, A: 255}, color.NRGBAModel.Convert(res.At(1, 1)))
+	})
+}
@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+)
+
+const (
+	vp8lSignature   = 0x2f
+	vp8lMaxSize     = 1 << 14
+	vp8lGreenSize   = 256 + 24 // literals + length prefix codes, no color cache
+	vp8lLiteralBits = 8
+)
+
+// EncodeWebPLossless writes image as lossless WebP (VP8L) container.
+// Encoder is intentionally minimal: no transforms, no backward references and fixed 8 bits prefix codes
+// for every channel, so output is close to raw ARGB size, but it is valid and readable by any WebP decoder.
+func EncodeWebPLossless(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 || width > vp8lMaxSize || height > vp8lMaxSize {
+		return errors.New("webp: invalid image size")
+	}
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+
+	opaque := nrgba.Opaque()
+	bw := &bitWriter{}
+	bw.writeBits(vp8lSignature, 8)
+	bw.writeBits(uint64(width-1), 14)
+	bw.writeBits(uint64(height-1), 14)
+	if opaque {
+		bw.writeBits(0, 1)
+	} else {
+		bw.writeBits(1, 1) // alpha is used hint
+	}
+	bw.writeBits(0, 3) // version
+	bw.writeBits(0, 1) // no transforms
+	bw.writeBits(0, 1) // no color cache
+	bw.writeBits(0, 1) // no meta prefix codes
+
+	bw.writeLiteralCode(vp8lGreenSize) // green
+	bw.writeLiteralCode(256)           // red
+	bw.writeLiteralCode(256)           // blue
+	if opaque {
+		bw.writeSimpleCode(0xff) // alpha is always 255, so no bits per pixel needed
+	} else {
+		bw.writeLiteralCode(256)
+	}
+	bw.writeSimpleCode(0) // distance, never used
+
+	for i := 0; i < len(nrgba.Pix); i += 4 {
+		bw.writeLiteral(nrgba.Pix[i+1]) // green
+		bw.writeLiteral(nrgba.Pix[i])   // red
+		bw.writeLiteral(nrgba.Pix[i+2]) // blue
+		if !opaque {
+			bw.writeLiteral(nrgba.Pix[i+3])
+		}
+	}
+	payload := bw.bytes()
+
+	chunkSize := len(payload)
+	padding := chunkSize & 1
+	header := make([]byte, 20)
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], uint32(4+8+chunkSize+padding))
+	copy(header[8:12], "WEBP")
+	copy(header[12:16], "VP8L")
+	binary.LittleEndian.PutUint32(header[16:20], uint32(chunkSize))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if padding == 1 {
+		payload = append(payload, 0)
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// bitWriter packs bits LSB first, as VP8L bitstream expects.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nBits uint
+}
+
+func (b *bitWriter) writeBits(value uint64, n uint) {
+	b.acc |= value << b.nBits
+	b.nBits += n
+	for b.nBits >= 8 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc >>= 8
+		b.nBits -= 8
+	}
+}
+
+// writeLiteral writes 8 bits prefix code, most significant bit first, as prefix codes are read bit by bit.
+func (b *bitWriter) writeLiteral(v byte) {
+	for i := vp8lLiteralBits - 1; i >= 0; i-- {
+		b.writeBits(uint64(v>>i)&1, 1)
+	}
+}
+
+// writeLiteralCode writes normal prefix code where first 256 symbols have length 8 and the rest are unused.
+// Code lengths are coded with two symbols code: `0` -> bit 0, `8` -> bit 1.
+func (b *bitWriter) writeLiteralCode(alphabetSize int) {
+	b.writeBits(0, 1) // normal code
+	// code length code order is 17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, so 12 lengths needed to reach symbol 8
+	b.writeBits(12-4, 4)
+	for i := 0; i < 12; i++ {
+		switch i {
+		case 2, 11: // symbols 0 and 8
+			b.writeBits(1, 3)
+		default:
+			b.writeBits(0, 3)
+		}
+	}
+	b.writeBits(0, 1) // max_symbol is alphabet size
+	for i := 0; i < alphabetSize; i++ {
+		if i < 256 {
+			b.writeBits(1, 1)
+		} else {
+			b.writeBits(0, 1)
+		}
+	}
+}
+
+// writeSimpleCode writes prefix code with the only symbol, which takes zero bits in data.
+func (b *bitWriter) writeSimpleCode(symbol byte) {
+	b.writeBits(1, 1) // simple code
+	b.writeBits(0, 1) // one symbol
+	if symbol > 1 {
+		b.writeBits(1, 1)
+		b.writeBits(uint64(symbol), 8)
+		return
+	}
+	b.writeBits(0, 1)
+	b.writeBits(uint64(symbol), 1)
+}
+
+func (b *bitWriter) bytes() []byte {
+	if b.nBits > 0 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc, b.nBits = 0, 0
+	}
+	return b.buf
+}